@@ -0,0 +1,457 @@
+package main
+
+import (
+	"strings"
+)
+
+// DTD 構文解析結果のルートとなるノード
+type DTD struct {
+	Declarations []Declaration
+}
+
+// Declaration <!ELEMENT ...> などのマークアップ宣言を表す
+type Declaration interface {
+	declaration()
+	String() string
+}
+
+// ElementDecl <!ELEMENT ...> 宣言
+type ElementDecl struct {
+	Name         string
+	Names        []string // 名前グループ (a|b) で複数の要素をまとめて宣言した場合の要素名(Nameは空)
+	Minimization bool     // SGMLのタグ省略指定が書かれているかどうか(XMLでは書かない)
+	OmitStartTag bool     // 開始タグの省略可否(SGMLのタグ省略指定)
+	OmitEndTag   bool     // 終了タグの省略可否(SGMLのタグ省略指定)
+	Content      ContentModel
+	Inclusions   []string
+	Exclusions   []string
+	Comments     []string // 宣言の中の -- と -- で囲まれたコメント
+}
+
+// ContentModel ELEMENT宣言の内容モデルを表す
+type ContentModel interface {
+	contentModel()
+	String() string
+}
+
+// EmptyContent EMPTY
+type EmptyContent struct{}
+
+// AnyContent ANY
+type AnyContent struct{}
+
+// DeclaredContent CDATAやRCDATAのようなSGMLの宣言内容
+type DeclaredContent struct {
+	Keyword string
+}
+
+// PCDataContent #PCDATA
+type PCDataContent struct{}
+
+// ElementContent 内容モデル中の子要素名
+type ElementContent struct {
+	Name       string
+	Occurrence Occurrence
+}
+
+// PEReferenceContent 内容モデル中の %name; のパラメータ実体参照
+type PEReferenceContent struct {
+	Name       string
+	Occurrence Occurrence
+}
+
+// Group (a,b)や(a|b)のような括弧で囲まれたモデル群
+type Group struct {
+	Connector  Connector
+	Children   []ContentModel
+	Occurrence Occurrence
+}
+
+// Connector モデル群の要素の区切り方
+type Connector string
+
+const (
+	ConnectorSequence Connector = "," // 順番通りに全て出現する
+	ConnectorChoice   Connector = "|" // いずれか1つが出現する
+	ConnectorAnd      Connector = "&" // 順不同で全て出現する(SGML)
+)
+
+// Occurrence 出現回数の指定
+type Occurrence string
+
+const (
+	OccurrenceOnce       Occurrence = ""
+	OccurrenceOptional   Occurrence = "?"
+	OccurrenceZeroOrMore Occurrence = "*"
+	OccurrenceOneOrMore  Occurrence = "+"
+)
+
+// AttListDecl <!ATTLIST ...> 宣言
+type AttListDecl struct {
+	Name       string
+	Names      []string // 名前グループ (a|b) で複数の要素の属性をまとめて定義した場合の要素名(Nameは空)
+	Attributes []AttDef
+	Comments   []string // 属性定義に付随しないコメント
+}
+
+// AttDef ATTLIST宣言内の属性定義1つ分
+type AttDef struct {
+	Reference   string // 属性定義の代わりに書かれた %name; のパラメータ実体参照の実体名
+	Name        string
+	Type        string   // CDATAやNAMEなどの属性の型(パラメータ実体参照は %name; のまま)
+	Enumeration []string // (a|b|c)のような列挙型の値(パラメータ実体参照は %name; のまま)
+	Default     DefaultType
+	Value       string   // 既定値(文字参照は展開済み)
+	Source      string   // 文字参照を含む既定値の、展開する前の値(含まない場合は空)
+	Comments    []string // 属性定義の直後に書かれたコメント
+}
+
+// DefaultType 属性の既定値の指定方法
+type DefaultType string
+
+const (
+	DefaultTypeImplied  DefaultType = "#IMPLIED"
+	DefaultTypeRequired DefaultType = "#REQUIRED"
+	DefaultTypeFixed    DefaultType = "#FIXED"
+	DefaultTypeCurrent  DefaultType = "#CURRENT" // 直前に指定された値(SGML)
+	DefaultTypeConRef   DefaultType = "#CONREF"  // 内容の代わりに参照する(SGML)
+	DefaultTypeValue    DefaultType = ""
+)
+
+// EntityDecl <!ENTITY ...> 宣言
+// 内部実体はValueに値を持ち、外部実体はExternalに外部識別子を持つ
+type EntityDecl struct {
+	Name       string
+	Parameter  bool           // パラメータ実体(<!ENTITY % name ...>)かどうか
+	DataType   EntityDataType // 実体の種類(通常の実体は空)
+	Value      string         // 内部実体の値(文字参照は展開済み)
+	Source     string         // 文字参照を含む値の、展開する前の値(含まない場合は空)
+	References []string       // 内部実体の値の中の &name; の一般実体参照の実体名
+	// PEReferences 内部実体の値の中の %name; のパラメータ実体参照の実体名
+	PEReferences []string
+	External     *ExternalID // 外部実体の外部識別子(内部実体はnil)
+	Notation     string      // NDATAなどの外部実体のデータの記法名
+	Comments     []string
+}
+
+// EntityDataType 実体の種類
+type EntityDataType string
+
+const (
+	EntityDataText     EntityDataType = ""         // 通常の実体
+	EntityDataCData    EntityDataType = "CDATA"    // 文字データ(SGML)
+	EntityDataSData    EntityDataType = "SDATA"    // 特殊文字データ(SGML)
+	EntityDataNData    EntityDataType = "NDATA"    // 解析対象外の実体
+	EntityDataPI       EntityDataType = "PI"       // 処理命令(SGML)
+	EntityDataStartTag EntityDataType = "STARTTAG" // 開始タグ(SGML)
+	EntityDataEndTag   EntityDataType = "ENDTAG"   // 終了タグ(SGML)
+	EntityDataMS       EntityDataType = "MS"       // マーク区間(SGML)
+	EntityDataMD       EntityDataType = "MD"       // マーク宣言(SGML)
+	EntityDataSubDoc   EntityDataType = "SUBDOC"   // 副文書(SGML)
+)
+
+// ExternalID SYSTEM "..." や PUBLIC "..." "..." の外部識別子
+type ExternalID struct {
+	PublicID string // 公開識別子(SYSTEMの場合は空)
+	SystemID string // システム識別子(SGMLでは省略できる)
+}
+
+// Unparsed 解析対象外の実体(NDATA)かどうか
+func (d *EntityDecl) Unparsed() bool {
+	return d.DataType == EntityDataNData
+}
+
+func (EmptyContent) contentModel()        {}
+func (AnyContent) contentModel()          {}
+func (DeclaredContent) contentModel()     {}
+func (PCDataContent) contentModel()       {}
+func (*ElementContent) contentModel()     {}
+func (*PEReferenceContent) contentModel() {}
+func (*Group) contentModel()              {}
+
+// NotationDecl <!NOTATION name SYSTEM "..."> 記法宣言
+// NDATAなどの外部実体のデータの記法名を宣言する
+type NotationDecl struct {
+	Name     string
+	External *ExternalID
+	Comments []string
+}
+
+// CommentDecl <!-- ... --> コメント宣言
+type CommentDecl struct {
+	Text string
+}
+
+// ProcessingInstructionDecl <?target data?> 処理命令
+type ProcessingInstructionDecl struct {
+	Target string
+	Data   string
+}
+
+// TextDecl <?xml version="1.0" encoding="UTF-8"?> 外部サブセットの先頭のテキスト宣言
+type TextDecl struct {
+	Version  string
+	Encoding string
+}
+
+// PEReferenceDecl 宣言の外に書いた %name; のパラメータ実体参照(展開しなかった外部実体など)
+type PEReferenceDecl struct {
+	Name string
+}
+
+// MarkedSection <![ INCLUDE [ ... ]]> のような条件付きセクション(SGMLのマーク区間)
+type MarkedSection struct {
+	Keywords     []string      // INCLUDEなどの予約語(パラメータ実体参照は %name; のまま)
+	Ignored      bool          // パラメータ実体を展開した結果、内容を読み飛ばしたかどうか
+	Declarations []Declaration // 読み飛ばさなかった場合の内容
+	Text         string        // 読み飛ばした場合の内容
+}
+
+func (*ElementDecl) declaration()               {}
+func (*AttListDecl) declaration()               {}
+func (*EntityDecl) declaration()                {}
+func (*NotationDecl) declaration()              {}
+func (*CommentDecl) declaration()               {}
+func (*MarkedSection) declaration()             {}
+func (*ProcessingInstructionDecl) declaration() {}
+func (*TextDecl) declaration()                  {}
+func (*PEReferenceDecl) declaration()           {}
+
+func (EmptyContent) String() string {
+	return Empty.Literal()
+}
+
+func (AnyContent) String() string {
+	return Any.Literal()
+}
+
+func (c DeclaredContent) String() string {
+	return c.Keyword
+}
+
+func (PCDataContent) String() string {
+	return PCData.Literal()
+}
+
+func (c *ElementContent) String() string {
+	return c.Name + string(c.Occurrence)
+}
+
+func (c *PEReferenceContent) String() string {
+	return referenceString(c.Name) + string(c.Occurrence)
+}
+
+func (c *Group) String() string {
+	children := make([]string, 0, len(c.Children))
+	for _, child := range c.Children {
+		children = append(children, child.String())
+	}
+	return "(" + strings.Join(children, string(c.Connector)) + ")" + string(c.Occurrence)
+}
+
+// Elements 宣言の対象の要素名。名前グループの場合はグループ中の全ての要素名
+func (d *ElementDecl) Elements() []string {
+	return declaredNames(d.Name, d.Names)
+}
+
+// Elements 属性を定義する対象の要素名。名前グループの場合はグループ中の全ての要素名
+func (d *AttListDecl) Elements() []string {
+	return declaredNames(d.Name, d.Names)
+}
+
+func declaredNames(name string, names []string) []string {
+	if len(names) > 0 {
+		return names
+	}
+	return []string{name}
+}
+
+// nameGroupString 名前グループであれば (a|b) の形式で返す
+func nameGroupString(name string, names []string) string {
+	if len(names) > 0 {
+		return "(" + strings.Join(names, "|") + ")"
+	}
+	return name
+}
+
+func (d *ElementDecl) String() string {
+	s := "<!ELEMENT " + nameGroupString(d.Name, d.Names)
+	if d.Minimization {
+		s += " " + tagMinimizationString(d.OmitStartTag) + " " + tagMinimizationString(d.OmitEndTag)
+	}
+	if d.Content != nil {
+		s += " " + d.Content.String()
+	}
+	// SGMLでは除外例外を包含例外より前に書く
+	if len(d.Exclusions) > 0 {
+		s += " -(" + strings.Join(d.Exclusions, "|") + ")"
+	}
+	if len(d.Inclusions) > 0 {
+		s += " +(" + strings.Join(d.Inclusions, "|") + ")"
+	}
+	return s + commentsString(d.Comments) + ">"
+}
+
+func (d *AttListDecl) String() string {
+	s := "<!ATTLIST " + nameGroupString(d.Name, d.Names) + commentsString(d.Comments)
+	for _, attr := range d.Attributes {
+		s += "\n  " + attr.String()
+	}
+	return s + ">"
+}
+
+func (a AttDef) String() string {
+	if a.Reference != "" {
+		return referenceString(a.Reference) + commentsString(a.Comments)
+	}
+	s := a.Name
+	if a.Type != "" {
+		s += " " + a.Type
+	}
+	if a.Enumeration != nil {
+		s += " (" + strings.Join(a.Enumeration, "|") + ")"
+	}
+	if a.Default != DefaultTypeValue {
+		s += " " + string(a.Default)
+	}
+	if a.Default == DefaultTypeValue || a.Default == DefaultTypeFixed {
+		s += " " + quoteLiteral(sourceOf(a.Value, a.Source))
+	}
+	return s + commentsString(a.Comments)
+}
+
+func (d *EntityDecl) String() string {
+	s := "<!ENTITY "
+	if d.Parameter {
+		s += "% "
+	}
+	s += d.Name
+	if d.External == nil {
+		if d.DataType != EntityDataText {
+			s += " " + string(d.DataType)
+		}
+		return s + " " + quoteLiteral(sourceOf(d.Value, d.Source)) + commentsString(d.Comments) + ">"
+	}
+	s += " " + d.External.String()
+	if d.DataType != EntityDataText {
+		s += " " + string(d.DataType)
+	}
+	if d.Notation != "" {
+		s += " " + d.Notation
+	}
+	return s + commentsString(d.Comments) + ">"
+}
+
+func (d *NotationDecl) String() string {
+	return "<!NOTATION " + d.Name + " " + d.External.String() + commentsString(d.Comments) + ">"
+}
+
+func (e *ExternalID) String() string {
+	s := "SYSTEM"
+	if e.PublicID != "" {
+		s = "PUBLIC " + quoteLiteral(e.PublicID)
+	}
+	if e.SystemID != "" {
+		s += " " + quoteLiteral(e.SystemID)
+	}
+	return s
+}
+
+func (d *CommentDecl) String() string {
+	return "<!--" + d.Text + "-->"
+}
+
+func (d *ProcessingInstructionDecl) String() string {
+	if d.Data == "" {
+		return "<?" + d.Target + "?>"
+	}
+	return "<?" + d.Target + " " + d.Data + "?>"
+}
+
+func (d *TextDecl) String() string {
+	s := "<?xml"
+	if d.Version != "" {
+		s += " version=" + quoteLiteral(d.Version)
+	}
+	if d.Encoding != "" {
+		s += " encoding=" + quoteLiteral(d.Encoding)
+	}
+	return s + "?>"
+}
+
+func (d *PEReferenceDecl) String() string {
+	return referenceString(d.Name)
+}
+
+func (d *MarkedSection) String() string {
+	s := "<!["
+	for _, keyword := range d.Keywords {
+		s += " " + keyword
+	}
+	s += " ["
+	if d.Ignored {
+		return s + d.Text + "]]>"
+	}
+	for _, decl := range d.Declarations {
+		s += "\n" + decl.String()
+	}
+	return s + "\n]]>"
+}
+
+// includedDeclarations 読み飛ばさなかった条件付きセクションの中の宣言を展開した宣言の一覧
+func includedDeclarations(decls []Declaration) []Declaration {
+	included := []Declaration{}
+	for _, decl := range decls {
+		if section, ok := decl.(*MarkedSection); ok {
+			included = append(included, includedDeclarations(section.Declarations)...)
+			continue
+		}
+		included = append(included, decl)
+	}
+	return included
+}
+
+func commentsString(comments []string) string {
+	s := ""
+	for _, comment := range comments {
+		s += " --" + comment + "--"
+	}
+	return s
+}
+
+func referenceString(name string) string {
+	return "%" + name + ";"
+}
+
+// isReference 名前が展開されていないパラメータ実体参照かどうか
+func isReference(name string) bool {
+	return strings.HasPrefix(name, "%")
+}
+
+func tagMinimizationString(omit bool) string {
+	if omit {
+		return "O"
+	}
+	return "-"
+}
+
+// sourceOf 文字参照を展開する前の値があればそちらを返す
+// &#38; を & に戻すと読み直したときに実体参照になってしまうため、書き出すときは元の値を使う
+func sourceOf(value, source string) string {
+	if source != "" {
+		return source
+	}
+	return value
+}
+
+// quoteLiteral 値に含まれない方の引用符で囲む
+// 文字参照を展開して両方の引用符を含む場合は " を文字参照に戻す
+func quoteLiteral(value string) string {
+	switch {
+	case strings.Contains(value, `"`) && strings.Contains(value, "'"):
+		return `"` + strings.ReplaceAll(value, `"`, "&#34;") + `"`
+	case strings.Contains(value, `"`):
+		return "'" + value + "'"
+	}
+	return `"` + value + `"`
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// isNameStartChar XMLのNameStartCharかどうか
+// https://www.w3.org/TR/xml/#NT-NameStartChar
+func isNameStartChar(r rune) bool {
+	switch {
+	case r < utf8.RuneSelf:
+		// 名前の直後の空白や記号も毎回判定するので、ASCIIは全角の記号の判定より先に済ませる
+		return r == ':' || r == '_' || ('A' <= r && r <= 'Z') || ('a' <= r && r <= 'z')
+	case isFullWidthPunctuation(r):
+		// XMLの規則では名前に使えるが、ほぼ間違いなく半角記号の打ち間違いなので名前として扱わない
+		return false
+	case r == utf8.RuneError:
+		// 不正なUTF-8のバイト列
+		return false
+	}
+	return (0xC0 <= r && r <= 0xD6) ||
+		(0xD8 <= r && r <= 0xF6) ||
+		(0xF8 <= r && r <= 0x2FF) ||
+		(0x370 <= r && r <= 0x37D) ||
+		(0x37F <= r && r <= 0x1FFF) ||
+		(0x200C <= r && r <= 0x200D) ||
+		(0x2070 <= r && r <= 0x218F) ||
+		(0x2C00 <= r && r <= 0x2FEF) ||
+		(0x3001 <= r && r <= 0xD7FF) ||
+		(0xF900 <= r && r <= 0xFDCF) ||
+		(0xFDF0 <= r && r <= 0xFFFD) ||
+		(0x10000 <= r && r <= 0xEFFFF)
+}
+
+// isNameChar XMLのNameCharかどうか
+// https://www.w3.org/TR/xml/#NT-NameChar
+func isNameChar(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isNameStartChar(r) || r == '-' || r == '.' || ('0' <= r && r <= '9')
+	}
+	return isNameStartChar(r) ||
+		r == '-' || r == '.' || ('0' <= r && r <= '9') || r == 0xB7 ||
+		(0x300 <= r && r <= 0x36F) ||
+		(0x203F <= r && r <= 0x2040)
+}
+
+// isChar XMLの文書に書ける文字かどうか
+// https://www.w3.org/TR/xml/#NT-Char
+func isChar(r rune) bool {
+	return r == 0x9 || r == 0xA || r == 0xD ||
+		(0x20 <= r && r <= 0xD7FF) ||
+		(0xE000 <= r && r <= 0xFFFD) ||
+		(0x10000 <= r && r <= 0x10FFFF)
+}
+
+// isFullWidthPunctuation 全角の記号や空白かどうか
+func isFullWidthPunctuation(r rune) bool {
+	ascii, ok := halfWidth(r)
+	return ok && !unicode.IsLetter(ascii) && !unicode.IsDigit(ascii)
+}
+
+// halfWidth 全角の英数字・記号・空白に対応する半角文字を返す
+func halfWidth(r rune) (rune, bool) {
+	switch {
+	case r == 0x3000:
+		return ' ', true
+	case 0xFF01 <= r && r <= 0xFF5E:
+		return r - 0xFEE0, true
+	}
+	return 0, false
+}
+
+// runeWidth 端末に表示した際の文字幅
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(0x3000 <= r && r <= 0x303F) || (0xFF01 <= r && r <= 0xFF60) || (0xFFE0 <= r && r <= 0xFFE6) {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// byteOrderMark 入力の先頭に置かれるUTF-8のBOM
+const byteOrderMark = '\uFEFF'
+
+// splitProcessingInstruction 処理命令の中身を対象名とそれ以降に分ける
+func splitProcessingInstruction(text string) (string, string) {
+	i := strings.IndexAny(text, " \t\r\n")
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimLeft(text[i:], " \t\r\n")
+}
+
+// parseTextDecl テキスト宣言の version="1.0" encoding="UTF-8" を読む
+// https://www.w3.org/TR/xml/#NT-TextDecl
+func parseTextDecl(data string) (string, string, error) {
+	version, encoding := "", ""
+	for rest := strings.TrimSpace(data); rest != ""; rest = strings.TrimLeft(rest, " \t\r\n") {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return "", "", fmt.Errorf("name=\"value\" instead of %q", rest)
+		}
+		name := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimLeft(rest[eq+1:], " \t\r\n")
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return "", "", fmt.Errorf("quoted value of %q", name)
+		}
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return "", "", fmt.Errorf("closing %q of %q", string(rest[0]), name)
+		}
+		value := rest[1 : end+1]
+		rest = rest[end+2:]
+		switch name {
+		case "version":
+			version = value
+		case "encoding":
+			encoding = value
+		case "standalone":
+			// 外部サブセットでは意味を持たないが、文書の先頭からDTDを読む場合に備えて許す
+		default:
+			return "", "", fmt.Errorf(`"version" or "encoding" instead of %q`, name)
+		}
+	}
+	return version, encoding, nil
+}
+
+// newCharsetReader encodingで符号化されたrをUTF-8として読めるようにする
+// UTF-8とUS-ASCIIはそのまま読むので、rをそのまま返す
+func newCharsetReader(encoding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToUpper(encoding) {
+	case "", "UTF-8", "UTF8", "US-ASCII", "ASCII":
+		return r, nil
+	case "ISO-8859-1", "ISO_8859-1", "LATIN1", "L1":
+		return &latin1Reader{r: bufio.NewReader(r)}, nil
+	}
+	return nil, fmt.Errorf(`"UTF-8", "US-ASCII" or "ISO-8859-1" instead of unsupported encoding %q`, encoding)
+}
+
+// latin1Reader ISO-8859-1の1バイトを同じ値のUnicodeの文字としてUTF-8に変換する
+type latin1Reader struct {
+	r *bufio.Reader
+}
+
+func (r *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	// 読み込み済みのバイトを変換し終えたら、次の入力を待たずに返す
+	for n+utf8.UTFMax <= len(p) && (n == 0 || r.r.Buffered() > 0) {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		n += utf8.EncodeRune(p[n:], rune(b))
+	}
+	if n == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	return n, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var ErrRecursiveEntity = errors.New("recursive parameter entity reference")
+var ErrExpansionLimit = errors.New("parameter entity expansion exceeds the size limit")
+
+const maxExpansionSize = 16 << 20 // 展開したパラメータ実体の値の合計の上限(バイト)
+
+// expander DTD中のパラメータ実体参照を実体の値に置き換える
+type expander struct {
+	input    string
+	entities map[string]parameterEntity // 宣言済みのパラメータ実体(同じ実体は最初の宣言を使う)
+	size     int                        // これまでに展開した値の合計のバイト数
+	output   bytes.Buffer               // 展開後の入力
+	segments []segment                  // 展開後の入力の各部分の出どころ(offset順)
+	lines    []int                      // 元の入力の各行の先頭のバイト位置
+}
+
+// segment 展開後の入力のoffsetから次のsegmentまでの部分の出どころ
+type segment struct {
+	offset    int    // 展開後の入力での開始位置
+	source    int    // 元の入力を写した部分の、元の入力での開始位置
+	reference *Token // 実体の値を展開した部分の場合の、元の入力の参照
+}
+
+func NewExpander(input string) *expander {
+	return &expander{input: input, entities: map[string]parameterEntity{}}
+}
+
+// Execute パラメータ実体参照を展開した入力を字句解析し、そのトークンを返す
+// トークンの位置は元の入力での位置になり、展開した値の中のトークンは参照の位置になる
+func (e *expander) Execute() ([]Token, error) {
+	expanded, err := e.Expand()
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := NewLexer(expanded).Execute()
+	if err != nil {
+		return nil, e.restoreError(err)
+	}
+	e.restoreTokens(tokens)
+	return tokens, nil
+}
+
+// ExecuteAll Executeと同じだが、失敗した宣言は読み飛ばして全ての失敗箇所をエラーとして返す
+func (e *expander) ExecuteAll() ([]Token, []error) {
+	expanded, errs := e.expandInput(true)
+	tokens, lexErrs := NewLexer(expanded).ExecuteAll()
+	for _, err := range lexErrs {
+		errs = append(errs, e.restoreError(err))
+	}
+	// 展開する前の失敗と展開した後の失敗を、元の入力での位置の順に並べる
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errorOffset(errs[i]) < errorOffset(errs[j])
+	})
+	e.restoreTokens(tokens)
+	return tokens, errs
+}
+
+// Expand パラメータ実体参照を展開した入力を返す
+// 値の分からない外部実体と、宣言されていない実体の参照はそのまま残す
+// 文字列、コメント、読み飛ばす条件付きセクションの中の参照は展開しない
+func (e *expander) Expand() (string, error) {
+	expanded, errs := e.expandInput(false)
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+	return expanded, nil
+}
+
+// expandInput 入力を展開し、展開後の入力の各部分の出どころをsegmentsに記録する
+// recoveringの場合は失敗した宣言を出力から除いて次の <! から展開を続け、全ての失敗を返す
+func (e *expander) expandInput(recovering bool) (string, []error) {
+	e.output.Reset()
+	e.segments = nil
+	errs := []error{}
+	// 宣言の中の位置を判定できるよう、元の入力はレキサーで読みながら参照を探す
+	// レキサーはパラメータ実体の宣言を読むとentitiesに追加する
+	l := NewTriviaLexer(e.input)
+	l.entities = e.entities
+	l.recovering = recovering
+	// mark 宣言の外で最後にトークンを読み終えた時点の出力の長さとsegmentsの数
+	markOutput, markSegments := 0, 0
+	for {
+		token, err := l.NextToken()
+		if err == io.EOF {
+			return e.output.String(), errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if !recovering || l.err != nil {
+				return "", errs
+			}
+			// 失敗した宣言の読めた部分を出力に残すと、展開後の字句解析で同じ箇所が再び失敗する
+			e.output.Truncate(markOutput)
+			e.segments = e.segments[:markSegments]
+			continue
+		}
+		if token.Type != PEReference {
+			e.copyText(token.Text(), token.Start.Offset-len(token.Leading))
+		} else if err := e.expandReference(l, token); err != nil {
+			errs = append(errs, err)
+			if !recovering {
+				return "", errs
+			}
+			e.copyText(token.Text(), token.Start.Offset-len(token.Leading))
+		}
+		if l.declaration == Illegal {
+			markOutput, markSegments = e.output.Len(), len(e.segments)
+		}
+	}
+}
+
+// expandReference 参照のトークンを、前後の空白とコメントも含めて実体の値に置き換えて出力する
+func (e *expander) expandReference(l *lexer, token Token) error {
+	value, ok, err := e.expand(token.Literal, nil)
+	if err != nil {
+		syntaxErr := &SyntaxError{Err: err, Pos: token.Start, Text: token.Raw}
+		l.attachSource(syntaxErr)
+		return syntaxErr
+	}
+	if !ok {
+		e.copyText(token.Text(), token.Start.Offset-len(token.Leading))
+		return nil
+	}
+	e.copyText(token.Leading, token.Start.Offset-len(token.Leading))
+	e.segments = append(e.segments, segment{offset: e.output.Len(), reference: &token})
+	// XMLと同じく、前後の名前などと繋がらないよう値の前後に空白を1つずつ加える
+	e.output.WriteString(" " + value + " ")
+	e.copyText(token.Trailing, token.End.Offset)
+	return nil
+}
+
+// copyText 元の入力のsourceの位置から始まるtextをそのまま出力する
+func (e *expander) copyText(text string, source int) {
+	if text == "" {
+		return
+	}
+	// 直前の部分と元の入力で連続している場合は1つの部分にまとめる
+	if n := len(e.segments); n > 0 {
+		last := e.segments[n-1]
+		if last.reference == nil && last.source+e.output.Len()-last.offset == source {
+			e.output.WriteString(text)
+			return
+		}
+	}
+	e.segments = append(e.segments, segment{offset: e.output.Len(), source: source})
+	e.output.WriteString(text)
+}
+
+// restoreTokens 展開後の入力でのトークンの位置を元の入力での位置に置き換える
+func (e *expander) restoreTokens(tokens []Token) {
+	for i := range tokens {
+		seg := e.segmentAt(tokens[i].Start.Offset)
+		if seg.reference != nil {
+			tokens[i].Start = seg.reference.Start
+			tokens[i].End = seg.reference.End
+			continue
+		}
+		start := seg.source + tokens[i].Start.Offset - seg.offset
+		end := start + tokens[i].End.Offset - tokens[i].Start.Offset
+		tokens[i].Start = e.position(start)
+		tokens[i].End = e.position(end)
+	}
+}
+
+// restoreError 展開後の入力で失敗した位置を元の入力での位置に置き換える
+// 展開した値の中で失敗した場合は参照の位置にし、参照をExpansionに持たせる
+func (e *expander) restoreError(err error) error {
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+	seg := e.segmentAt(syntaxErr.Pos.Offset)
+	if seg.reference != nil {
+		syntaxErr.Pos = seg.reference.Start
+		syntaxErr.Expansion = seg.reference.Raw
+	} else {
+		syntaxErr.Pos = e.position(seg.source + syntaxErr.Pos.Offset - seg.offset)
+	}
+	syntaxErr.source = e.input
+	syntaxErr.sourceOffset = 0
+	return err
+}
+
+// segmentAt 展開後の入力のoffsetの位置を含む部分
+func (e *expander) segmentAt(offset int) segment {
+	i := sort.Search(len(e.segments), func(i int) bool {
+		return e.segments[i].offset > offset
+	})
+	if i == 0 {
+		return segment{}
+	}
+	return e.segments[i-1]
+}
+
+// position 元の入力のoffsetの位置の行番号と桁番号をレキサーと同じ数え方で求める
+func (e *expander) position(offset int) Position {
+	if offset > len(e.input) {
+		offset = len(e.input)
+	}
+	if e.lines == nil {
+		e.lines = []int{0}
+		for i := 0; i < len(e.input); i++ {
+			if e.input[i] == WhiteSpaceLFSymbol {
+				e.lines = append(e.lines, i+1)
+			}
+		}
+	}
+	line := sort.Search(len(e.lines), func(i int) bool {
+		return e.lines[i] > offset
+	})
+	lineStart := e.lines[line-1]
+	column := utf8.RuneCountInString(e.input[lineStart:offset]) + 1
+	// BOMは桁番号に数えない
+	if lineStart == 0 && offset > 0 && strings.HasPrefix(e.input, string(byteOrderMark)) {
+		column--
+	}
+	return Position{Offset: offset, Line: line, Column: column}
+}
+
+// errorOffset 失敗した位置のバイト単位のインデックス。位置を持たないエラーは先頭として扱う
+func errorOffset(err error) int {
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Pos.Offset
+	}
+	return 0
+}
+
+// expand nameの実体の値を、値の中の参照も展開して返す。展開しない実体の場合はfalseを返す
+// chainは展開中の実体名で、値が自分自身を参照している場合はその経路をエラーにする
+func (e *expander) expand(name string, chain []string) (string, bool, error) {
+	entity, ok := e.entities[name]
+	if !ok || entity.external {
+		return "", false, nil
+	}
+	value := entity.value
+	// 呼び出し元のchainを書き換えないよう、常に新しいスライスに追加する
+	chain = append(chain[:len(chain):len(chain)], name)
+	for _, expanding := range chain[:len(chain)-1] {
+		if expanding == name {
+			return "", false, errors.Wrap(ErrRecursiveEntity, referenceChain(chain))
+		}
+	}
+	e.size += len(value)
+	if e.size > maxExpansionSize {
+		return "", false, errors.Wrap(ErrExpansionLimit, referenceChain(chain))
+	}
+
+	// 値の中の参照は宣言した時点で展開されるものとして、引用符の中も含めて全て置き換える
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(value, PercentSymbol)
+		if i < 0 {
+			b.WriteString(value)
+			break
+		}
+		b.WriteString(value[:i])
+		value = value[i:]
+		ref, n := scanReference(value)
+		if n == 0 {
+			b.WriteByte(PercentSymbol)
+			value = value[1:]
+			continue
+		}
+		expanded, ok, err := e.expand(ref, chain)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			b.WriteString(expanded)
+		} else {
+			b.WriteString(value[:n])
+		}
+		value = value[n:]
+	}
+	return b.String(), true, nil
+}
+
+// scanReference sの先頭の %name; か %name の実体名と長さを返す。参照でない場合は長さ0を返す
+func scanReference(s string) (string, int) {
+	n := 1
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if (n == 1 && !isNameStartChar(r)) || !isNameChar(r) {
+			break
+		}
+		n += size
+	}
+	if n == 1 {
+		return "", 0
+	}
+	name := s[1:n]
+	if n < len(s) && s[n] == SemicolonSymbol {
+		n++
+	}
+	return name, n
+}
+
+// referenceChain 展開中の実体名を %a; -> %b; -> %a; の形式で返す
+func referenceChain(chain []string) string {
+	refs := make([]string, 0, len(chain))
+	for _, name := range chain {
+		refs = append(refs, referenceString(name))
+	}
+	return strings.Join(refs, " -> ")
+}
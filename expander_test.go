@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpander(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_内容モデル",
+			input: `<!ENTITY % inline "#PCDATA|em"><!ELEMENT p - O (%inline;)*>`,
+			want:  `<!ENTITY % inline "#PCDATA|em"><!ELEMENT p - O ( #PCDATA|em )*>`,
+		},
+		{
+			name:  "成功ケース_値の中の参照も展開する",
+			input: "<!ENTITY % a \"x|%b;\">\n<!ENTITY % b '%c;|y'>\n<!ENTITY % c \"z\">\n<!ELEMENT p - O (%a;)>",
+			want:  "<!ENTITY % a \"x|%b;\">\n<!ENTITY % b '%c;|y'>\n<!ENTITY % c \"z\">\n<!ELEMENT p - O ( x|z|y )>",
+		},
+		{
+			name:  "成功ケース_同じ実体は最初の宣言を使う",
+			input: `<!ENTITY % a "x"><!ENTITY % a "y"><!ELEMENT p - O (%a;)>`,
+			want:  `<!ENTITY % a "x"><!ENTITY % a "y"><!ELEMENT p - O ( x )>`,
+		},
+		{
+			name:  "成功ケース_同じ実体を繰り返し参照する",
+			input: `<!ENTITY % a "x"><!ENTITY % b "%a;,%a;"><!ELEMENT p - O (%b;)>`,
+			want:  `<!ENTITY % a "x"><!ENTITY % b "%a;,%a;"><!ELEMENT p - O ( x,x )>`,
+		},
+		{
+			name:  "成功ケース_宣言の外の参照",
+			input: "<!ENTITY % decls '<!ELEMENT p - O EMPTY>'>\n%decls;\n",
+			want:  "<!ENTITY % decls '<!ELEMENT p - O EMPTY>'>\n <!ELEMENT p - O EMPTY> \n",
+		},
+		{
+			name:  "成功ケース_外部実体と宣言されていない実体は展開しない",
+			input: "<!ENTITY % lat1 SYSTEM \"lat1.ent\">\n%lat1;\n<!ELEMENT p - O (%inline;)>",
+			want:  "<!ENTITY % lat1 SYSTEM \"lat1.ent\">\n%lat1;\n<!ELEMENT p - O (%inline;)>",
+		},
+		{
+			name:  "成功ケース_先に外部実体として宣言した実体は後の内部実体の宣言でも展開しない",
+			input: `<!ENTITY % a SYSTEM "a.ent"><!ENTITY % a "(x)"><!ELEMENT p - O %a;>`,
+			want:  `<!ENTITY % a SYSTEM "a.ent"><!ENTITY % a "(x)"><!ELEMENT p - O %a;>`,
+		},
+		{
+			name:  "成功ケース_先に外部実体として宣言した実体は条件付きセクションの予約語にしない",
+			input: `<!ENTITY % b SYSTEM "b.ent"><!ENTITY % b "IGNORE"><!ENTITY % c "x"><![ %b; [ <!ELEMENT p - O (%c;)> ]]>`,
+			want:  `<!ENTITY % b SYSTEM "b.ent"><!ENTITY % b "IGNORE"><!ENTITY % c "x"><![ %b; [ <!ELEMENT p - O ( x )> ]]>`,
+		},
+		{
+			name:  "成功ケース_文字列とコメントの中は展開しない",
+			input: `<!ENTITY % a "x"><!-- %a; --><!ATTLIST p b CDATA "%a;">`,
+			want:  `<!ENTITY % a "x"><!-- %a; --><!ATTLIST p b CDATA "%a;">`,
+		},
+		{
+			name:  "成功ケース_読み飛ばす条件付きセクションの中は展開しない",
+			input: `<!ENTITY % draft "IGNORE"><!ENTITY % a "x"><![ %draft; [ <!ELEMENT p - O (%a;)> ]]>`,
+			want:  `<!ENTITY % draft "IGNORE"><!ENTITY % a "x"><![  IGNORE  [ <!ELEMENT p - O (%a;)> ]]>`,
+		},
+		{
+			name:  "成功ケース_文字参照で書いた値",
+			input: `<!ENTITY % a "&#x23;PCDATA"><!ELEMENT p - O (%a;)>`,
+			want:  `<!ENTITY % a "&#x23;PCDATA"><!ELEMENT p - O ( #PCDATA )>`,
+		},
+		{
+			name:    "自分自身を参照する実体でエラーが発生する",
+			input:   `<!ENTITY % a "x|%a;"><!ELEMENT p - O (%a;)>`,
+			want:    "",
+			wantErr: ErrRecursiveEntity,
+		},
+		{
+			name:    "互いに参照する実体でエラーが発生する",
+			input:   `<!ENTITY % a "%b;"><!ENTITY % b "(%a;)"><!ELEMENT p - O %a;>`,
+			want:    "",
+			wantErr: ErrRecursiveEntity,
+		},
+		{
+			name:    "字句解析に失敗するとエラーが発生する",
+			input:   `<!ENTITY % a "x"><!ELEMINT p - O (%a;)>`,
+			want:    "",
+			wantErr: ErrElementTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewExpander(tt.input)
+			got, err := sut.Expand()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpanderParse(t *testing.T) {
+	// 展開したトークンをそのまま構文解析できる
+	input := `<!ENTITY % attrs "id ID #IMPLIED">
+<!ENTITY % inline "#PCDATA|%phrase;">
+<!ENTITY % phrase "em|strong">
+<!ELEMENT p - O (%inline;)*>
+<!ATTLIST p %attrs; lang NAME #IMPLIED>`
+	tokens, err := NewExpander(input).Execute()
+	if err != nil {
+		t.Fatalf("failed to expand input: %v", err)
+	}
+	got, err := NewParser(tokens).Execute()
+	if err != nil {
+		t.Fatalf("failed to parse input: %v", err)
+	}
+	want := []Declaration{
+		&ElementDecl{
+			Name:         "p",
+			Minimization: true,
+			OmitEndTag:   true,
+			Content: &Group{
+				Connector: ConnectorChoice,
+				Children: []ContentModel{
+					PCDataContent{},
+					&ElementContent{Name: "em"},
+					&ElementContent{Name: "strong"},
+				},
+				Occurrence: OccurrenceZeroOrMore,
+			},
+		},
+		&AttListDecl{
+			Name: "p",
+			Attributes: []AttDef{
+				{Name: "id", Type: "ID", Default: DefaultTypeImplied},
+				{Name: "lang", Type: "NAME", Default: DefaultTypeImplied},
+			},
+		},
+	}
+	if diff := cmp.Diff(got.Declarations[3:], want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestExpanderError(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantMessage string
+		wantSnippet string
+	}{
+		{
+			name:        "参照の経路を表示する",
+			input:       "<!ENTITY % a \"%b;\">\n<!ENTITY % b \"(%c;)\">\n<!ENTITY % c \"x|%a;\">\n<!ELEMENT p - O %a;>",
+			wantMessage: `4:17: %a; -> %b; -> %c; -> %a;: recursive parameter entity reference: found "%a;"`,
+			wantSnippet: "<!ELEMENT p - O %a;>\n                ^~~",
+		},
+		{
+			name:        "自分自身の参照",
+			input:       "<!ENTITY % a \"%a;\">\n%a;",
+			wantMessage: `2:1: %a; -> %a;: recursive parameter entity reference: found "%a;"`,
+			wantSnippet: "%a;\n^~~",
+		},
+		{
+			name:        "展開した値の中の失敗は参照の位置に表示する",
+			input:       "<!ENTITY % d '<!ELEMINT p - O EMPTY>'>\n  %d;",
+			wantMessage: "2:3: failed to element tokenize: ELEMINT: did you mean ELEMENT? (in expansion of %d;)",
+			wantSnippet: "  %d;\n  ^~~",
+		},
+		{
+			name:        "展開した値より後ろの失敗は元の入力の位置に表示する",
+			input:       "<!ENTITY % o \"<!\">\n%o;ELEMINT p - O EMPTY>",
+			wantMessage: "2:4: failed to element tokenize: ELEMINT: did you mean ELEMENT?",
+			wantSnippet: "%o;ELEMINT p - O EMPTY>\n   ^~~~~~~",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpander(tt.input).Execute()
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("error is not SyntaxError: %v", err)
+			}
+			if diff := cmp.Diff(syntaxErr.Error(), tt.wantMessage); diff != "" {
+				t.Errorf("message mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(syntaxErr.Snippet(), tt.wantSnippet); diff != "" {
+				t.Errorf("snippet mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpanderExecuteAll(t *testing.T) {
+	input := "<!ENTITY % d '<!ELEMINT p - O EMPTY>'>\n%d;\n<!ELEMINT q - O EMPTY>\n<!ENTITY % a \"x\">\n<!ELEMENT r - O (%a;)>"
+	tokens, errs := NewExpander(input).ExecuteAll()
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"2:1: failed to element tokenize: ELEMINT: did you mean ELEMENT? (in expansion of %d;)",
+		"3:3: failed to element tokenize: ELEMINT: did you mean ELEMENT?",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("errors mismatch (-got +want):\n%s", diff)
+	}
+
+	// 展開した値の中のトークンは参照の位置、それ以外は元の入力での位置になる
+	var positions []string
+	for _, token := range tokens[len(tokens)-4:] {
+		positions = append(positions, token.Literal+" "+token.Start.String()+"-"+token.End.String())
+	}
+	wantPositions := []string{"( 5:17-5:18", "x 5:18-5:21", ") 5:21-5:22", "> 5:22-5:23"}
+	if diff := cmp.Diff(positions, wantPositions); diff != "" {
+		t.Errorf("positions mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestExpanderLimit(t *testing.T) {
+	// 参照のたびに10倍になる実体を入れ子にしても、上限を超えた時点で展開をやめる
+	input := `<!ENTITY % a0 "x">`
+	for i := 1; i <= 9; i++ {
+		ref := "%a" + string(rune('0'+i-1)) + ";"
+		input += `<!ENTITY % a` + string(rune('0'+i)) + ` "` + strings.Repeat(ref, 10) + `">`
+	}
+	input += `<!ELEMENT p - O (%a9;)>`
+	_, err := NewExpander(input).Expand()
+	if !errors.Is(err, ErrExpansionLimit) {
+		t.Errorf("error mismatch want: %v, but got %v", ErrExpansionLimit, err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+var ErrGenerate = errors.New("failed to generate")
+
+// xmlNamespace xml: の接頭辞に割り当てられた名前空間のURI
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+type generator struct {
+	dtd         *DTD
+	packageName string
+}
+
+func NewGenerator(dtd *DTD, packageName string) *generator {
+	return &generator{dtd: dtd, packageName: packageName}
+}
+
+// structField 生成する構造体のフィールド1つ分
+type structField struct {
+	name    string
+	goType  string
+	tag     string
+	comment string
+}
+
+// childElement 内容モデルから集めた子要素
+type childElement struct {
+	name     string
+	repeated bool // 複数回出現しうる
+	optional bool // 出現しない場合がある
+}
+
+func (g *generator) Execute() ([]byte, error) {
+	elements := []*ElementDecl{}
+	declared := map[string]bool{}
+	attributes := map[string][]AttDef{}
+	for _, decl := range includedDeclarations(g.dtd.Declarations) {
+		switch d := decl.(type) {
+		case *ElementDecl:
+			// 名前グループの場合は要素ごとに同じ内容の構造体を生成する
+			for _, name := range d.Elements() {
+				// %heading; のようなパラメータ実体参照は展開しないとどの要素か分からないので生成しない
+				// 同じ要素が複数回宣言された場合は最初の宣言を使う
+				if isReference(name) || declared[name] {
+					continue
+				}
+				declared[name] = true
+				el := *d
+				el.Name, el.Names = name, nil
+				elements = append(elements, &el)
+			}
+		case *AttListDecl:
+			for _, name := range d.Elements() {
+				// 同じ属性が複数回定義された場合は最初の定義を使う
+				for _, def := range d.Attributes {
+					// パラメータ実体参照の属性定義は展開しないと分からないので生成しない
+					if def.Reference != "" {
+						continue
+					}
+					if !hasAttribute(attributes[name], def.Name) {
+						attributes[name] = append(attributes[name], def)
+					}
+				}
+			}
+		}
+	}
+
+	// html.content と HTMLContent のように別の要素が同じ型名になる場合は連番を付ける
+	typeNames := map[string]string{}
+	usedTypes := map[string]bool{}
+	for _, el := range elements {
+		base := goIdentifier(el.Name)
+		name := base
+		for i := 2; usedTypes[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		usedTypes[name] = true
+		typeNames[el.Name] = name
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by go-dtd. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", g.packageName)
+	if len(elements) > 0 {
+		fmt.Fprintf(buf, "import \"encoding/xml\"\n\n")
+	}
+	for _, el := range elements {
+		fields := g.structFields(el, attributes[el.Name], typeNames)
+		fmt.Fprintf(buf, "type %s struct {\n", typeNames[el.Name])
+		fmt.Fprintf(buf, "XMLName xml.Name `xml:\"%s\"`\n", xmlName(el.Name))
+		for _, f := range fields {
+			fmt.Fprintf(buf, "%s %s `xml:\"%s\"`", f.name, f.goType, f.tag)
+			if f.comment != "" {
+				fmt.Fprintf(buf, " // %s", f.comment)
+			}
+			fmt.Fprintf(buf, "\n")
+		}
+		fmt.Fprintf(buf, "}\n\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(ErrGenerate, err.Error())
+	}
+	return src, nil
+}
+
+// structFields 要素の構造体のフィールドを返す。typeNamesは宣言された要素の構造体の型名
+func (g *generator) structFields(el *ElementDecl, attrs []AttDef, typeNames map[string]string) []structField {
+	fields := []structField{}
+	used := map[string]bool{"XMLName": true}
+	addField := func(f structField) {
+		// フィールド名が衝突した場合は連番を付ける
+		name := f.name
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s%d", f.name, i)
+		}
+		used[name] = true
+		f.name = name
+		fields = append(fields, f)
+	}
+
+	children, text := collectChildren(el.Content)
+	for _, name := range el.Inclusions {
+		children = mergeChild(children, childElement{name: name, repeated: true, optional: true})
+	}
+	for _, child := range children {
+		goType, declared := typeNames[child.name]
+		if !declared {
+			goType = "string"
+		}
+		switch {
+		case child.repeated:
+			goType = "[]" + goType
+		case child.optional && declared:
+			goType = "*" + goType
+		}
+		addField(structField{name: goIdentifier(child.name), goType: goType, tag: xmlName(child.name)})
+	}
+
+	for _, attr := range attrs {
+		name := goIdentifier(attr.Name)
+		if used[name] {
+			name += "Attr"
+		}
+		addField(structField{
+			name:    name,
+			goType:  "string",
+			tag:     xmlName(attr.Name) + ",attr",
+			comment: commentText(attr.Comments),
+		})
+	}
+
+	switch {
+	case el.Content == AnyContent{}:
+		// ANYはどの要素も文字データも書けるので、内容をそのままのXMLで持たせる
+		addField(structField{name: "InnerXML", goType: "string", tag: ",innerxml"})
+	case text:
+		addField(structField{name: "Text", goType: "string", tag: ",chardata"})
+	}
+	return fields
+}
+
+// collectChildren 内容モデルから子要素と文字データの有無を集める
+func collectChildren(model ContentModel) ([]childElement, bool) {
+	children := []childElement{}
+	text := false
+	var walk func(m ContentModel, repeated, optional bool)
+	walk = func(m ContentModel, repeated, optional bool) {
+		switch c := m.(type) {
+		case PCDataContent, DeclaredContent:
+			text = true
+		case *ElementContent:
+			children = mergeChild(children, childElement{
+				name:     c.Name,
+				repeated: repeated || c.Occurrence == OccurrenceZeroOrMore || c.Occurrence == OccurrenceOneOrMore,
+				optional: optional || c.Occurrence == OccurrenceZeroOrMore || c.Occurrence == OccurrenceOptional,
+			})
+		case *Group:
+			repeated = repeated || c.Occurrence == OccurrenceZeroOrMore || c.Occurrence == OccurrenceOneOrMore
+			optional = optional || c.Occurrence == OccurrenceZeroOrMore || c.Occurrence == OccurrenceOptional
+			// 選択の場合はどの子要素も出現しない可能性がある
+			for _, child := range c.Children {
+				walk(child, repeated, optional || (c.Connector == ConnectorChoice && len(c.Children) > 1))
+			}
+		}
+	}
+	walk(model, false, false)
+	return children, text
+}
+
+// mergeChild 同じ名前の子要素が複数回出現する場合は繰り返しとしてまとめる
+func mergeChild(children []childElement, child childElement) []childElement {
+	for i := range children {
+		if children[i].name == child.name {
+			children[i].repeated = true
+			children[i].optional = children[i].optional || child.optional
+			return children
+		}
+	}
+	return append(children, child)
+}
+
+// commentText DTD中のコメントを1行のGoのコメントに変換する
+func commentText(comments []string) string {
+	texts := []string{}
+	for _, comment := range comments {
+		if text := strings.Join(strings.Fields(comment), " "); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+func hasAttribute(attrs []AttDef, name string) bool {
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// xmlName 要素名や属性名をencoding/xmlのタグに書く名前に変換する
+// encoding/xmlは接頭辞ではなく名前空間のURIと局所名で照合するので、xml:lang は名前空間のURIと lang にする
+// 他の接頭辞の名前空間のURIはDTDからは分からないので、局所名だけで照合する
+func xmlName(name string) string {
+	i := strings.IndexByte(name, ':')
+	if i < 0 || i == len(name)-1 {
+		return name
+	}
+	switch prefix, local := name[:i], name[i+1:]; prefix {
+	case "xml":
+		return xmlNamespace + " " + local
+	case "xmlns":
+		// 名前空間の宣言の属性はencoding/xmlでも xmlns を名前空間として扱う
+		return "xmlns " + local
+	default:
+		return local
+	}
+}
+
+// goIdentifier html.contentのような要素名をHtmlContentのようなGoの識別子に変換する
+func goIdentifier(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	ident := ""
+	for _, part := range parts {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		ident += string(runes)
+	}
+	if ident == "" || unicode.IsDigit([]rune(ident)[0]) {
+		ident = "X" + ident
+	}
+	return ident
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/xml"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerator(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "成功ケース_子要素と属性",
+			input: `
+<!ELEMENT person - - (name,age?,license*)>
+<!ELEMENT name - - (#PCDATA)>
+<!ELEMENT age - - (#PCDATA)>
+<!ELEMENT license - - (#PCDATA)>
+<!ATTLIST person id NAME #REQUIRED>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type Person struct {
+	XMLName xml.Name  ` + "`xml:\"person\"`" + `
+	Name    Name      ` + "`xml:\"name\"`" + `
+	Age     *Age      ` + "`xml:\"age\"`" + `
+	License []License ` + "`xml:\"license\"`" + `
+	Id      string    ` + "`xml:\"id,attr\"`" + `
+}
+
+type Name struct {
+	XMLName xml.Name ` + "`xml:\"name\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+
+type Age struct {
+	XMLName xml.Name ` + "`xml:\"age\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+
+type License struct {
+	XMLName xml.Name ` + "`xml:\"license\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_繰り返しの選択と宣言されていない子要素",
+			input: `
+<!ELEMENT p - - (#PCDATA|em|strong)*>
+<!ELEMENT em - - (#PCDATA)>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type P struct {
+	XMLName xml.Name ` + "`xml:\"p\"`" + `
+	Em      []Em     ` + "`xml:\"em\"`" + `
+	Strong  []string ` + "`xml:\"strong\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+
+type Em struct {
+	XMLName xml.Name ` + "`xml:\"em\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_要素名と属性名が衝突",
+			input: `
+<!ELEMENT html.head - - (title?) +(meta)>
+<!ATTLIST html.head title CDATA #IMPLIED>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type HtmlHead struct {
+	XMLName   xml.Name ` + "`xml:\"html.head\"`" + `
+	Title     string   ` + "`xml:\"title\"`" + `
+	Meta      []string ` + "`xml:\"meta\"`" + `
+	TitleAttr string   ` + "`xml:\"title,attr\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_属性のコメント",
+			input: `
+<!ELEMENT a - - (#PCDATA)>
+<!ATTLIST a href CDATA #IMPLIED -- URI for
+                                   linked resource -->
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type A struct {
+	XMLName xml.Name ` + "`xml:\"a\"`" + `
+	Href    string   ` + "`xml:\"href,attr\"`" + ` // URI for linked resource
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_条件付きセクション",
+			input: `
+<!ENTITY % HTML.Reserved "IGNORE">
+<![ INCLUDE [
+<!ELEMENT br - O EMPTY>
+]]>
+<![ %HTML.Reserved; [
+<!ELEMENT reserved - - EMPTY>
+]]>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type Br struct {
+	XMLName xml.Name ` + "`xml:\"br\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_型名が衝突",
+			input: `
+<!ELEMENT a-b - - EMPTY>
+<!ELEMENT AB - - (a-b)>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type AB struct {
+	XMLName xml.Name ` + "`xml:\"a-b\"`" + `
+}
+
+type AB2 struct {
+	XMLName xml.Name ` + "`xml:\"AB\"`" + `
+	AB      AB       ` + "`xml:\"a-b\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_パラメータ実体参照の要素名は生成しない",
+			input: `
+<!ELEMENT %heading; - - (#PCDATA)>
+<!ELEMENT (%list;|dl) - - EMPTY>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type Dl struct {
+	XMLName xml.Name ` + "`xml:\"dl\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_名前グループ",
+			input: `
+<!ELEMENT (sub|sup) - - (#PCDATA)>
+<!ATTLIST (sub|sup) id ID #IMPLIED>
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type Sub struct {
+	XMLName xml.Name ` + "`xml:\"sub\"`" + `
+	Id      string   ` + "`xml:\"id,attr\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+
+type Sup struct {
+	XMLName xml.Name ` + "`xml:\"sup\"`" + `
+	Id      string   ` + "`xml:\"id,attr\"`" + `
+	Text    string   ` + "`xml:\",chardata\"`" + `
+}
+`,
+		},
+		{
+			name: "成功ケース_名前空間の接頭辞とANY",
+			input: `
+<!ELEMENT svg:g - - ANY>
+<!ATTLIST svg:g xml:lang CDATA #IMPLIED xmlns:svg CDATA #FIXED "http://www.w3.org/2000/svg">
+`,
+			want: `// Code generated by go-dtd. DO NOT EDIT.
+
+package dtd
+
+import "encoding/xml"
+
+type SvgG struct {
+	XMLName  xml.Name ` + "`xml:\"g\"`" + `
+	XmlLang  string   ` + "`xml:\"http://www.w3.org/XML/1998/namespace lang,attr\"`" + `
+	XmlnsSvg string   ` + "`xml:\"xmlns svg,attr\"`" + `
+	InnerXML string   ` + "`xml:\",innerxml\"`" + `
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			dtd, err := NewParser(tokens).Execute()
+			if err != nil {
+				t.Fatalf("failed to parse input: %v", err)
+			}
+			sut := NewGenerator(dtd, "dtd")
+			got, err := sut.Execute()
+			if err != nil {
+				t.Fatalf("failed to generate: %v", err)
+			}
+			if diff := cmp.Diff(string(got), tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGeneratorUnmarshal(t *testing.T) {
+	// 生成した構造体にencoding/xmlで文書を読み込める
+	input := `
+<!ELEMENT svg:g - - ANY>
+<!ATTLIST svg:g id ID #IMPLIED xml:lang CDATA #IMPLIED xml:space (default|preserve) "preserve">
+`
+	dtd, err := NewStreamParser(NewLexer(input)).Execute()
+	if err != nil {
+		t.Fatalf("failed to parse input: %v", err)
+	}
+	src, err := NewGenerator(dtd, "dtd").Execute()
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	v := reflect.New(generatedStruct(t, src, "SvgG"))
+	doc := `<svg:g xmlns:svg="http://www.w3.org/2000/svg" id="a" xml:lang="ja" xml:space="preserve"><svg:rect/>text</svg:g>`
+	if err := xml.Unmarshal([]byte(doc), v.Interface()); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	got := map[string]string{}
+	for _, name := range []string{"Id", "XmlLang", "XmlSpace", "InnerXML"} {
+		got[name] = v.Elem().FieldByName(name).String()
+	}
+	want := map[string]string{
+		"Id":       "a",
+		"XmlLang":  "ja",
+		"XmlSpace": "preserve",
+		"InnerXML": "<svg:rect/>text",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+// generatedStruct 生成したソースの構造体をreflectで組み立てる。フィールドはstringとxml.Nameのみ扱う
+func generatedStruct(t *testing.T, src []byte, name string) reflect.Type {
+	t.Helper()
+	file, err := goparser.ParseFile(gotoken.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse generated source: %v", err)
+	}
+	spec, ok := file.Scope.Lookup(name).Decl.(*goast.TypeSpec)
+	if !ok {
+		t.Fatalf("type %s is not generated", name)
+	}
+	fields := []reflect.StructField{}
+	for _, f := range spec.Type.(*goast.StructType).Fields.List {
+		var typ reflect.Type
+		switch expr := types.ExprString(f.Type); expr {
+		case "string":
+			typ = reflect.TypeOf("")
+		case "xml.Name":
+			typ = reflect.TypeOf(xml.Name{})
+		default:
+			t.Fatalf("unsupported field type %s", expr)
+		}
+		tag, err := strconv.Unquote(f.Tag.Value)
+		if err != nil {
+			t.Fatalf("failed to unquote tag: %v", err)
+		}
+		fields = append(fields, reflect.StructField{Name: f.Names[0].Name, Type: typ, Tag: reflect.StructTag(tag)})
+	}
+	return reflect.StructOf(fields)
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/pkg/errors"
 )
 
@@ -9,328 +16,1405 @@ var ErrEmptyTokenize = errors.New("failed to empty tokenize")
 var ErrAttListTokenize = errors.New("failed to attlist tokenize")
 var ErrDefaultValueTokenize = errors.New("failed to default value tokenize")
 var ErrStringTokenize = errors.New("failed to string tokenize")
+var ErrReferenceTokenize = errors.New("failed to reference tokenize")
 var ErrTagNecessityTokenize = errors.New("failed to tag necessity tokenize")
 var ErrEntityTokenize = errors.New("failed to entity tokenize")
+var ErrCommentTokenize = errors.New("failed to comment tokenize")
+var ErrDeclarationTokenize = errors.New("failed to declaration tokenize")
+var ErrCharacterTokenize = errors.New("failed to character tokenize")
+var ErrNotationTokenize = errors.New("failed to notation tokenize")
+var ErrMarkedSectionTokenize = errors.New("failed to marked section tokenize")
+var ErrProcessingInstructionTokenize = errors.New("failed to processing instruction tokenize")
+var ErrTextDeclTokenize = errors.New("failed to text declaration tokenize")
+
+const (
+	ExclamationSymbol        = '!'
+	LeftAngleBracketSymbol   = '<'
+	RightAngleBracketSymbol  = '>'
+	WhiteSpaceSymbol         = ' '
+	WhiteSpaceTabSymbol      = '\t'
+	WhiteSpaceCRSymbol       = '\r'
+	WhiteSpaceLFSymbol       = '\n'
+	LeftBracketSymbol        = '('
+	RightBracketSymbol       = ')'
+	CommaSymbol              = ','
+	AsteriskSymbol           = '*'
+	AmpersandSymbol          = '&'
+	VerticalLineSymbol       = '|'
+	PlusSymbol               = '+'
+	QuestionSymbol           = '?'
+	MinusSymbol              = '-'
+	SharpSymbol              = '#'
+	QuoteSymbol              = '\''
+	DoubleQuoteSymbol        = '"'
+	PercentSymbol            = '%'
+	SemicolonSymbol          = ';'
+	LeftSquareBracketSymbol  = '['
+	RightSquareBracketSymbol = ']'
+)
 
 const (
-	ExclamationSymbol            = '!'
-	LeftAngleBracketSymbol       = '<'
-	RightAngleBracketSymbol      = '>'
-	ElementOrEmptyorEntitySymbol = 'E'
-	WhiteSpaceSymbol             = ' '
-	WhiteSpaceTabSymbol          = '\t'
-	WhiteSpaceCRSymbol           = '\r'
-	WhiteSpaceLFSymbol           = '\n'
-	LeftBracketSymbol            = '('
-	RightBracketSymbol           = ')'
-	CommaSymbol                  = ','
-	AsteriskSymbol               = '*'
-	TagNeedSymbol                = '-'
-	TagUnNeedSymbol              = 'O'
-	AmpersandSymbol              = '&'
-	VerticalLineSymbol           = '|'
-	PlusSymbol                   = '+'
-	QuestionSymbol               = '?'
-	MinusSymbol                  = '-'
-	AttListSymbol                = 'A'
-	SharpSymbol                  = '#'
-	QuoteSymbol                  = '\''
-	DoubleQuoteSymbol            = '"'
-	PercentSymbol                = '%'
+	readChunkSize  = 4096 // io.Readerから1度に読み込むバイト数
+	snippetContext = 256  // エラー表示のためにトークンの前に残しておく最大のバイト数
+
+	maxExpansionDepth = 16 // パラメータ実体の展開の深さの上限
 )
 
 type lexer struct {
-	input        string
-	position     int  // 読み込んでる文字のインデックス
-	readPosition int  // 次に読み込む文字のインデックス
-	ch           byte // 検査中の文字
+	input        string // 読み込み済みの入力(文字列から読む場合のみ)
+	base         int    // inputかbufの先頭の、入力全体でのバイト単位のインデックス
+	position     int    // 読み込んでる文字のバイト単位のインデックス
+	readPosition int    // 次に読み込む文字のバイト単位のインデックス
+	ch           rune   // 検査中の文字
+	line         int    // 検査中の文字の行番号
+	column       int    // 検査中の文字の桁番号(文字単位)
+	lineStart    int    // 検査中の文字の行の先頭のバイト単位のインデックス
+
+	reader         io.Reader         // 続きの入力の読み込み元(全て読み込み済みの場合はnil)
+	buf            []byte            // readerから読み込んだ入力のうち処理中の部分(io.Readerから読む場合のみ)
+	names          map[string]string // 読み込んだ名前(io.Readerから読む場合のみ)
+	readErr        error             // readerからの読み込みで発生したエラー
+	err            error             // 字句解析を続けられなくなったエラー(入力の終わりのio.EOFを含む)
+	tokenStart     int               // 読み込み中のトークンの先頭のバイト単位のインデックス
+	tokenLineStart int               // 読み込み中のトークンの行の先頭のバイト単位のインデックス
+
+	// 予約語を判定するための宣言の中での位置
+	declaration TokenType // 読み込み中の宣言の種類(<と<!の直後はそれぞれの記号、宣言の外ではIllegal)
+	declIndex   int       // 宣言の予約語から数えたトークンの位置
+	depth       int       // 宣言の中の括弧の深さ
+	lastType    TokenType // 宣言の中で直前に読んだトークンの種類
+	attDef      int       // ATTLIST宣言の中で次に読む属性定義の項目
+	elementItem int       // ELEMENT宣言の中で括弧の外で読んだ項目の数(名前グループは全体で1つ)
+
+	// 条件付きセクションの予約語をパラメータ実体から解決するための状態
+	entities        map[string]parameterEntity // これまでに宣言されたパラメータ実体
+	entityName      string                     // 読み込み中のパラメータ実体の宣言の実体名
+	sectionKeywords []Token                    // 読み込み中の <![ と [ の間の予約語とパラメータ実体参照
+	sections        []Position                 // 開いている条件付きセクションの <![ の位置
+	ignoring        TokenType                  // 次に内容を読み飛ばす条件付きセクションの種類(IGNORE, CDATA, RCDATA)
+
+	started bool // トークンを1つ以上読んだかどうか(テキスト宣言は先頭にしか書けない)
+
+	externalID bool // SYSTEMやPUBLICの後の文字列かどうか(外部識別子の中の参照は解釈しない)
+
+	recovering  bool   // 失敗しても次の <! から字句解析を再開するかどうか
+	trivia      bool   // 空白とコメントをトークンに持たせるかどうか
+	triviaStart int    // 読み込み中のトークンの前の空白とコメントの開始位置
+	atEOF       bool   // EOFトークンを返したかどうか
+	tokenCursor cursor // 読み込み中のトークンの先頭の文字を読んだ時点の読み込み位置
 }
 
+// cursor 失敗したトークンの先頭まで戻って再開するための読み込み位置
+type cursor struct {
+	position     int
+	readPosition int
+	ch           rune
+	line         int
+	column       int
+	lineStart    int
+}
+
+// parameterEntity 宣言済みのパラメータ実体
+type parameterEntity struct {
+	value    string // 内部実体の値
+	external bool   // SYSTEMやPUBLICで宣言した外部実体など、値が分からず展開できない実体かどうか
+}
+
+// mark 現在の読み込み位置を返す
+func (l *lexer) mark() cursor {
+	return cursor{
+		position:     l.position,
+		readPosition: l.readPosition,
+		ch:           l.ch,
+		line:         l.line,
+		column:       l.column,
+		lineStart:    l.lineStart,
+	}
+}
+
+// restore markで記録した読み込み位置に戻る
+func (l *lexer) restore(c cursor) {
+	l.position = c.position
+	l.readPosition = c.readPosition
+	l.ch = c.ch
+	l.line = c.line
+	l.column = c.column
+	l.lineStart = c.lineStart
+}
+
+// ATTLIST宣言の中で次に読む項目
+const (
+	attDefElement = iota // 要素名
+	attDefName           // 属性名
+	attDefType           // 属性の型
+	attDefDefault        // 既定値
+	attDefFixed          // #FIXEDの後の既定値
+)
+
 func NewLexer(input string) *lexer {
-	return &lexer{input: input}
+	return &lexer{input: input, line: 1}
+}
+
+// NewTriviaLexer 空白とコメントをトークンの前後に持たせ、トークンを繋げると元の入力を復元できるレキサーを返す
+// コメントはトークンにならず、入力の末尾にはEOFトークンを返す。整形ツールなどで使う
+// テキスト宣言で符号化方式を切り替えた場合、それ以降は復号した文字列になる
+func NewTriviaLexer(input string) *lexer {
+	return &lexer{input: input, line: 1, trivia: true}
+}
+
+// NewReaderLexer rから少しずつ読み込みながら字句解析するレキサーを返す
+// 字句解析を終えた部分は捨てるので、大きなDTDでもメモリ使用量はほぼ一定になる
+func NewReaderLexer(r io.Reader) *lexer {
+	return &lexer{reader: r, buf: make([]byte, 0, readChunkSize), names: map[string]string{}, line: 1}
+}
+
+// ExecuteAll 失敗しても次の <! から字句解析を再開し、読めた全てのトークンと全てのエラーを返す
+// 入力の読み込みに失敗した場合はそこで終わる
+func (l *lexer) ExecuteAll() ([]Token, []error) {
+	l.recovering = true
+	tokens := []Token{}
+	errs := []error{}
+	for {
+		token, err := l.NextToken()
+		if err == io.EOF {
+			return tokens, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if l.err != nil {
+				return tokens, errs
+			}
+			continue
+		}
+		tokens = append(tokens, token)
+	}
 }
 
 func (l *lexer) Execute() ([]Token, error) {
 	tokens := []Token{}
-	for ch := l.readChar(); l.readPosition <= len(l.input); ch = l.readChar() {
+	for {
+		token, err := l.NextToken()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// NextToken 次のトークンを1つ読む。入力を全て読み終えた場合はio.EOFを返す
+func (l *lexer) NextToken() (Token, error) {
+	if l.err != nil {
+		return Token{}, l.err
+	}
+	l.triviaStart = l.readPosition
+	if l.ignoring != Illegal {
+		token, err := l.ignoredSectionTokenize()
+		if err != nil {
+			if !l.recovering || l.readErr != nil {
+				l.err = err
+			}
+			return Token{}, err
+		}
+		if l.trivia {
+			l.attachTrivia(&token)
+		}
+		return token, nil
+	}
+	for {
+		ch := l.readChar()
+		if l.readPosition > l.end() && l.trivia && !l.atEOF && l.readErr == nil {
+			// 末尾の空白とコメントはEOFトークンに持たせる
+			l.atEOF = true
+			end := l.currentPosition()
+			end.Offset = l.end()
+			// 失敗後に入力の末尾まで読み飛ばした場合、triviaStartは末尾を越えている
+			if l.triviaStart > l.end() {
+				l.triviaStart = l.end()
+			}
+			return Token{
+				Type:    EOF,
+				Start:   end,
+				End:     end,
+				Leading: l.literal(l.triviaStart, l.end()),
+			}, nil
+		}
+		if l.readPosition > l.end() {
+			l.err = io.EOF
+			if l.readErr != nil {
+				l.err = l.readErr
+			}
+			return Token{}, l.err
+		}
+		// トークンの間の空白は多いので、トークンの開始位置を記録する前に読み飛ばす
+		if ch == WhiteSpaceSymbol || ch == WhiteSpaceTabSymbol || ch == WhiteSpaceCRSymbol || ch == WhiteSpaceLFSymbol {
+			continue
+		}
+		l.tokenStart = l.position
+		l.tokenLineStart = l.lineStart
+		l.tokenCursor = l.mark()
+		start := l.currentPosition()
+		var token Token
+		var err error
 		switch {
+		case ch == byteOrderMark && l.position == 0:
+			// BOMは桁番号に数えない
+			l.column = 0
+			continue
+		case ch == LeftAngleBracketSymbol && l.peakChar() == QuestionSymbol:
+			token, err = l.processingInstructionTokenize()
+		case ch == LeftAngleBracketSymbol && l.hasPrefix("!["):
+			l.readChar()
+			l.readChar()
+			token = Token{
+				Type:    MarkedSectionStart,
+				Literal: MarkedSectionStart.Literal(),
+			}
+		case ch == RightSquareBracketSymbol && l.hasPrefix("]>"):
+			l.readChar()
+			l.readChar()
+			token = Token{
+				Type:    MarkedSectionEnd,
+				Literal: MarkedSectionEnd.Literal(),
+			}
+		case ch == LeftSquareBracketSymbol:
+			token = Token{
+				Type:    LeftSquareBracket,
+				Literal: LeftSquareBracket.Literal(),
+			}
+		case ch == LeftAngleBracketSymbol && l.hasPrefix("!--"):
+			token, err = l.commentTokenize()
 		case ch == LeftAngleBracketSymbol:
-			tokens = append(tokens, Token{
-				Type:    TokenType(LeftAngleBracket),
-				Literal: string(ch),
-			})
+			token = Token{
+				Type:    LeftAngleBracket,
+				Literal: LeftAngleBracket.Literal(),
+			}
 		case ch == RightAngleBracketSymbol:
-			tokens = append(tokens, Token{
-				Type:    TokenType(RightAngleBracket),
-				Literal: string(ch),
-			})
+			token = Token{
+				Type:    RightAngleBracket,
+				Literal: RightAngleBracket.Literal(),
+			}
 		case ch == ExclamationSymbol:
-			tokens = append(tokens, Token{
-				Type:    TokenType(Exclamation),
-				Literal: string(ch),
-			})
-		case ch == ElementOrEmptyorEntitySymbol:
-			nextChar := l.peakChar()
-			if nextChar == 'L' {
-				token, err := l.elementTokenize()
-				if err != nil {
-					return nil, err
-				}
-				tokens = append(tokens, *token)
-			}
-			if nextChar == 'M' {
-				token, err := l.emptyTokenize()
-				if err != nil {
-					return nil, err
-				}
-				tokens = append(tokens, *token)
-			}
-			if nextChar == 'N' {
-				token, err := l.entityTokenize()
-				if err != nil {
-					return nil, err
-				}
-				tokens = append(tokens, *token)
-			}
-		case ch == WhiteSpaceSymbol || ch == WhiteSpaceTabSymbol || ch == WhiteSpaceCRSymbol || ch == WhiteSpaceLFSymbol:
-			continue
-		case ch == AttListSymbol:
-			token, err := l.attListTokenize()
-			if err != nil {
-				return nil, err
+			token = Token{
+				Type:    Exclamation,
+				Literal: Exclamation.Literal(),
 			}
-			tokens = append(tokens, *token)
 		case ch == LeftBracketSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    LeftBracket,
-				Literal: string(ch),
-			})
+				Literal: LeftBracket.Literal(),
+			}
 		case ch == RightBracketSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    RightBracket,
-				Literal: string(ch),
-			})
+				Literal: RightBracket.Literal(),
+			}
 		case ch == CommaSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Comma,
-				Literal: string(ch),
-			})
+				Literal: Comma.Literal(),
+			}
 		case ch == AmpersandSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Ampersand,
-				Literal: string(ch),
-			})
+				Literal: Ampersand.Literal(),
+			}
 		case ch == AsteriskSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Asterisk,
-				Literal: string(ch),
-			})
+				Literal: Asterisk.Literal(),
+			}
 		case ch == VerticalLineSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    VerticalLine,
-				Literal: string(ch),
-			})
+				Literal: VerticalLine.Literal(),
+			}
 		case ch == PlusSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Plus,
-				Literal: string(ch),
-			})
+				Literal: Plus.Literal(),
+			}
+		case ch == MinusSymbol && l.peakChar() == MinusSymbol:
+			token, err = l.inlineCommentTokenize()
+		case ch == MinusSymbol && isNameChar(l.peakChar()):
+			// (-1|0|1) のような - から始まる名前トークン
+			token, err = l.nameTokenize()
 		case ch == MinusSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Minus,
-				Literal: string(ch),
-			})
-		case ch == QuoteSymbol || ch == DoubleQuoteSymbol:
-			token, err := l.stringTokenize(ch)
-			if err != nil {
-				return nil, err
+				Literal: Minus.Literal(),
 			}
-			tokens = append(tokens, *token)
+		case ch == QuoteSymbol || ch == DoubleQuoteSymbol:
+			token, err = l.stringTokenize(ch)
 		case ch == SharpSymbol:
-			token, err := l.defaulValueTokenize()
-			if err != nil {
-				return nil, err
-			}
-			tokens = append(tokens, *token)
+			token, err = l.defaulValueTokenize()
 		case ch == QuestionSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Question,
-				Literal: string(ch),
-			})
-		case ch == TagNeedSymbol:
-			tokens = append(tokens, Token{
-				Type:    TagNeed,
-				Literal: string(ch),
-			})
-		case ch == TagUnNeedSymbol:
-			tokens = append(tokens, Token{
-				Type:    TagUnNeed,
-				Literal: string(ch),
-			})
+				Literal: Question.Literal(),
+			}
+		case ch == PercentSymbol && isNameStartChar(l.peakChar()):
+			token, err = l.peReferenceTokenize()
 		case ch == PercentSymbol:
-			tokens = append(tokens, Token{
+			token = Token{
 				Type:    Percent,
-				Literal: string(ch),
-			})
+				Literal: Percent.Literal(),
+			}
+		case ch == SemicolonSymbol:
+			token = Token{
+				Type:    Semicolon,
+				Literal: Semicolon.Literal(),
+			}
+		case isNameChar(ch):
+			token, err = l.nameTokenize()
 		default:
-			token, err := l.nameTokenize()
+			err = l.characterError()
+		}
+		if err == nil && l.trivia && token.Type == Comment {
+			// コメントは次のトークンの前の空白と合わせて持たせる
+			l.started = true
+			continue
+		}
+		if err == nil {
+			token.Start = start
+			token.End = l.nextPosition()
+			err = l.classify(&token)
+		}
+		if err == nil && token.Type == ProcessingInstruction {
+			err = l.textDeclClassify(token)
+		}
+		if err != nil {
+			// 入力の読み込みに失敗して途切れた場合は読み込みのエラーを優先する
+			if l.readErr != nil {
+				err = l.readErr
+			}
+			if l.recovering && l.readErr == nil {
+				l.resync()
+			} else {
+				l.err = err
+			}
+			return Token{}, err
+		}
+		l.started = true
+		if l.trivia {
+			l.attachTrivia(&token)
+		}
+		return token, nil
+	}
+}
+
+// attachTrivia トークンに前の空白とコメント、入力中の文字列、同じ行の後ろの空白を持たせる
+func (l *lexer) attachTrivia(token *Token) {
+	token.Leading = l.literal(l.triviaStart, token.Start.Offset)
+	token.Raw = l.literal(token.Start.Offset, token.End.Offset)
+	// 読み飛ばす条件付きセクションの内容は空白も含めて次のトークンになる
+	if l.ignoring != Illegal {
+		return
+	}
+	trailingStart := l.readPosition
+	for ch := l.peakChar(); ch == WhiteSpaceSymbol || ch == WhiteSpaceTabSymbol; ch = l.peakChar() {
+		l.readChar()
+	}
+	token.Trailing = l.literal(trailingStart, l.readPosition)
+}
+
+// resync 失敗したトークンの先頭の文字の直後まで戻り、次の <! まで読み飛ばす
+func (l *lexer) resync() {
+	l.restore(l.tokenCursor)
+
+	// 宣言の途中の状態は捨てる。開いている条件付きセクションはそのまま続ける
+	l.declaration = Illegal
+	l.depth = 0
+	l.sectionKeywords = nil
+	l.ignoring = Illegal
+	l.externalID = false
+	for !l.hasPrefix("<!") {
+		if l.readChar() == 0 && l.readPosition > l.end() {
+			return
+		}
+	}
+}
+
+// declarationKeywords <!の直後に書ける予約語と、綴りを誤った場合のエラー
+var declarationKeywords = []struct {
+	keyword TokenType
+	err     error
+}{
+	{keyword: Element, err: ErrElementTokenize},
+	{keyword: AttList, err: ErrAttListTokenize},
+	{keyword: Entity, err: ErrEntityTokenize},
+	{keyword: Notation, err: ErrNotationTokenize},
+	{keyword: ShortRef, err: ErrDeclarationTokenize},
+	{keyword: UseMap, err: ErrDeclarationTokenize},
+}
+
+// contentKeywords ELEMENT宣言の宣言内容になる予約語
+var contentKeywords = []TokenType{Empty, Any, CData, RCData}
+
+// attributeTypes ATTLIST宣言の属性の型になる予約語
+var attributeTypes = []TokenType{
+	CData, Entity, Notation,
+	AttTypeID, AttTypeIDRef, AttTypeIDRefs, AttTypeEntities, AttTypeNMToken, AttTypeNMTokens,
+	AttTypeName, AttTypeNames, AttTypeNumber, AttTypeNumbers, AttTypeNuToken, AttTypeNuTokens,
+}
+
+// entityKeywords ENTITY宣言とNOTATION宣言の名前の後に書ける予約語
+var entityKeywords = []TokenType{
+	System, Public, NData, CData,
+	EntityTypeSData, EntityTypePI, EntityTypeStartTag, EntityTypeEndTag, EntityTypeMS, EntityTypeMD, EntityTypeSubDoc,
+}
+
+// classify 宣言の中での位置からNameトークンが予約語かどうかを判定し、宣言の中での位置を進める
+func (l *lexer) classify(token *Token) error {
+	switch token.Type {
+	case Comment, ProcessingInstruction:
+		return nil
+	case LeftAngleBracket:
+		l.declaration = LeftAngleBracket
+		return nil
+	case Exclamation:
+		if l.declaration == LeftAngleBracket {
+			l.declaration = Exclamation
+		}
+		return nil
+	case RightAngleBracket:
+		l.declaration = Illegal
+		l.depth = 0
+		l.externalID = false
+		return nil
+	case MarkedSectionStart:
+		l.declaration = MarkedSectionStart
+		l.sectionKeywords = nil
+		l.sections = append(l.sections, token.Start)
+		return nil
+	case LeftSquareBracket:
+		if l.declaration == MarkedSectionStart {
+			l.declaration = Illegal
+			return l.sectionClassify()
+		}
+		return nil
+	case MarkedSectionEnd:
+		if len(l.sections) > 0 {
+			l.sections = l.sections[:len(l.sections)-1]
+		}
+		// <![ IGNORE ]]> のように [ がないまま閉じた場合
+		if l.declaration == MarkedSectionStart {
+			l.declaration = Illegal
+			l.sectionKeywords = nil
+			err := &SyntaxError{
+				Err:      ErrMarkedSectionTokenize,
+				Pos:      token.Start,
+				Text:     token.Literal,
+				Expected: fmt.Sprintf("%q", LeftSquareBracket.Literal()),
+			}
+			l.attachSource(err)
+			return err
+		}
+		return nil
+	case PEReference:
+		if l.declaration == MarkedSectionStart {
+			l.sectionKeywords = append(l.sectionKeywords, *token)
+			return nil
+		}
+	case LeftBracket:
+		l.depth += 1
+	case RightBracket:
+		l.depth -= 1
+	case Name:
+		if l.declaration == Exclamation {
+			return l.declarationClassify(token)
+		}
+		if l.declaration == MarkedSectionStart {
+			return l.sectionKeywordClassify(token)
+		}
+	}
+	switch l.declaration {
+	case Element:
+		if l.depth == 0 {
+			l.elementClassify(token)
+		}
+	case AttList:
+		l.attListClassify(token)
+	case Entity, Notation:
+		if l.depth == 0 {
+			l.entityClassify(token)
+		}
+	}
+	if l.declaration == LeftAngleBracket || l.declaration == Exclamation {
+		l.declaration = Illegal
+	}
+	if token.Type == System || token.Type == Public {
+		l.externalID = true
+	}
+	l.declIndex += 1
+	l.lastType = token.Type
+	return nil
+}
+
+// declarationClassify <!の直後の名前を宣言の種類として判定する
+func (l *lexer) declarationClassify(token *Token) error {
+	for _, k := range declarationKeywords {
+		if token.Literal == k.keyword.Literal() {
+			token.Type = k.keyword
+			l.declaration = k.keyword
+			l.declIndex = 1
+			l.depth = 0
+			l.attDef = attDefElement
+			l.elementItem = 0
+			l.entityName = ""
+			return nil
+		}
+	}
+
+	keywords := []TokenType{}
+	for _, k := range declarationKeywords {
+		keywords = append(keywords, k.keyword)
+	}
+	err := &SyntaxError{
+		Err:      ErrDeclarationTokenize,
+		Pos:      token.Start,
+		Text:     token.Literal,
+		Expected: keywordList(keywords),
+	}
+	l.attachSource(err)
+	// 綴りが近い予約語があればその予約語の綴り誤りとみなす
+	if suggestion := suggestKeyword(token.Literal, keywords); suggestion != "" {
+		for _, k := range declarationKeywords {
+			if k.keyword.Literal() == suggestion {
+				err.Err = k.err
+				err.Expected = fmt.Sprintf("%q", k.keyword.Literal())
+				err.Suggestion = suggestion
+			}
+		}
+		return err
+	}
+	// 先頭が一致する予約語があればその予約語の綴り誤りとみなす
+	longest := 0
+	for _, k := range declarationKeywords {
+		n := commonPrefixLength(token.Literal, k.keyword.Literal())
+		if n > longest {
+			longest = n
+			err.Err = k.err
+			err.Expected = fmt.Sprintf("%q", k.keyword.Literal())
+		}
+	}
+	return err
+}
+
+// elementClassify ELEMENT宣言のタグ省略指定、例外、宣言内容を判定する
+// <!ELEMENT name - O EMPTY> の name は要素名なので予約語にはならない
+// 括弧の外のトークンでのみ呼ばれ、名前グループ (a|b) は閉じ括弧で1つの項目と数える
+func (l *lexer) elementClassify(token *Token) {
+	isFlag := (token.Type == Minus || token.Type == Name) && (token.Literal == "-" || token.Literal == "O")
+	next := l.peakNonSpaceChar()
+	switch {
+	// タグ省略指定は要素名か名前グループの直後に開始タグと終了タグの2つが並ぶ
+	case isFlag && l.elementItem == 1 && (next == MinusSymbol || next == 'O'),
+		isFlag && l.elementItem == 2 && (l.lastType == TagNeed || l.lastType == TagUnNeed):
+		if token.Literal == "O" {
+			token.Type = TagUnNeed
+		} else {
+			token.Type = TagNeed
+		}
+	// 直後に括弧が続く場合は出現回数ではなく例外
+	case token.Type == Plus && next == LeftBracketSymbol:
+		token.Type = Inclusion
+	case token.Type == Minus && next == LeftBracketSymbol:
+		token.Type = Exclusion
+	case token.Type == Name && l.elementItem >= 1:
+		if keyword, ok := findKeyword(token.Literal, contentKeywords); ok {
+			token.Type = keyword
+		}
+	}
+	l.elementItem++
+}
+
+// attListClassify ATTLIST宣言の属性の型を判定し、属性定義の中での位置を進める
+// <!ATTLIST name type type #IMPLIED> の属性名と既定値は予約語にはならない
+func (l *lexer) attListClassify(token *Token) {
+	// 括弧の中は閉じ括弧までで1つの項目になる
+	if l.depth > 0 {
+		return
+	}
+	switch l.attDef {
+	case attDefElement:
+		l.attDef = attDefName
+	case attDefName:
+		// %attrs; のようなパラメータ実体参照は属性定義全体になる
+		if token.Type != PEReference {
+			l.attDef = attDefType
+		}
+	case attDefType:
+		if token.Type == Name {
+			if keyword, ok := findKeyword(token.Literal, attributeTypes); ok {
+				token.Type = keyword
+			}
+		}
+		// NOTATION (a|b) は列挙が続く
+		if token.Type != Notation {
+			l.attDef = attDefDefault
+		}
+	case attDefDefault:
+		if token.Type == DefaultValueFixed {
+			l.attDef = attDefFixed
+		} else {
+			l.attDef = attDefName
+		}
+	case attDefFixed:
+		l.attDef = attDefName
+	}
+}
+
+// entityClassify ENTITY宣言とNOTATION宣言の外部識別子や実体の種類を判定する
+// <!ENTITY % name ...> の name は実体名なので予約語にはならない
+func (l *lexer) entityClassify(token *Token) {
+	isName := l.declIndex == 1 || (l.declIndex == 2 && l.lastType == Percent)
+	// 条件付きセクションの予約語を解決できるよう、パラメータ実体の値を覚えておく
+	// 同じ実体が複数回宣言された場合は、外部実体の宣言であっても最初の宣言を使う
+	if isName && l.lastType == Percent && token.Type == Name {
+		l.entityName = token.Literal
+	}
+	if l.declIndex == 3 && l.lastType == Name && l.entityName != "" {
+		if l.entities == nil {
+			l.entities = map[string]parameterEntity{}
+		}
+		if _, ok := l.entities[l.entityName]; !ok {
+			if token.Type == String {
+				l.entities[l.entityName] = parameterEntity{value: token.Literal}
+			} else {
+				l.entities[l.entityName] = parameterEntity{external: true}
+			}
+		}
+	}
+	// NDATAなどの直後は記法名
+	isNotation := l.lastType == NData || l.lastType == CData || l.lastType == EntityTypeSData
+	if token.Type != Name || isName || isNotation {
+		return
+	}
+	if keyword, ok := findKeyword(token.Literal, entityKeywords); ok {
+		token.Type = keyword
+	}
+}
+
+// sectionKeywords 条件付きセクションとマーク区間の状態を表す予約語
+var sectionKeywords = []TokenType{Include, Ignore, CData, RCData, Temp}
+
+// sectionKeywordClassify <![ と [ の間の名前を条件付きセクションの予約語として判定する
+func (l *lexer) sectionKeywordClassify(token *Token) error {
+	keyword, ok := findKeyword(token.Literal, sectionKeywords)
+	if !ok {
+		err := &SyntaxError{
+			Err:        ErrMarkedSectionTokenize,
+			Pos:        token.Start,
+			Text:       token.Literal,
+			Expected:   keywordList(sectionKeywords),
+			Suggestion: suggestKeyword(token.Literal, sectionKeywords),
+		}
+		l.attachSource(err)
+		return err
+	}
+	token.Type = keyword
+	l.sectionKeywords = append(l.sectionKeywords, *token)
+	return nil
+}
+
+// sectionClassify パラメータ実体を展開して条件付きセクションの状態を決め、
+// 内容を読み飛ばす場合は次のトークンで内容をまとめて読むようにする
+func (l *lexer) sectionClassify() error {
+	keywords := []TokenType{}
+	for _, token := range l.sectionKeywords {
+		expanded, err := l.expandSectionKeyword(token, token.Literal, 0)
+		if err != nil {
+			return err
+		}
+		keywords = append(keywords, expanded...)
+	}
+	// 複数の予約語が指定された場合は IGNORE, CDATA, RCDATA, INCLUDE の順に優先する
+	for _, status := range []TokenType{Ignore, CData, RCData} {
+		if hasType(keywords, status) {
+			l.ignoring = status
+			return nil
+		}
+	}
+	return nil
+}
+
+// expandSectionKeyword 条件付きセクションの予約語かパラメータ実体参照をINCLUDEなどの予約語の一覧に展開する
+func (l *lexer) expandSectionKeyword(token Token, literal string, depth int) ([]TokenType, error) {
+	if token.Type != PEReference {
+		return []TokenType{token.Type}, nil
+	}
+	entity, ok := l.entities[literal]
+	// 値の分からない外部実体は予約語を指定しないもの(INCLUDE)として扱う
+	if ok && entity.external {
+		return nil, nil
+	}
+	// 実体の値が自分自身を参照している場合に展開が終わらないよう深さを制限する
+	if !ok || depth >= maxExpansionDepth {
+		err := &SyntaxError{
+			Err:      ErrMarkedSectionTokenize,
+			Pos:      token.Start,
+			Text:     referenceString(token.Literal),
+			Expected: "parameter entity declared with " + keywordList(sectionKeywords),
+		}
+		if !ok {
+			if suggestion := suggest(literal, l.entityNames()); suggestion != "" {
+				err.Suggestion = referenceString(suggestion)
+			}
+		}
+		l.attachSource(err)
+		return nil, err
+	}
+	keywords := []TokenType{}
+	for _, field := range strings.Fields(entity.value) {
+		if strings.HasPrefix(field, "%") {
+			expanded, err := l.expandSectionKeyword(token, strings.TrimSuffix(field[1:], ";"), depth+1)
 			if err != nil {
 				return nil, err
 			}
-			tokens = append(tokens, *token)
+			keywords = append(keywords, expanded...)
 			continue
 		}
+		keyword, ok := findKeyword(field, sectionKeywords)
+		if !ok {
+			err := &SyntaxError{
+				Err:        ErrMarkedSectionTokenize,
+				Pos:        token.Start,
+				Text:       referenceString(token.Literal),
+				Expected:   fmt.Sprintf("%s instead of %q", keywordList(sectionKeywords), field),
+				Suggestion: suggestKeyword(field, sectionKeywords),
+			}
+			if err.Suggestion != "" {
+				err.Text = field
+			}
+			l.attachSource(err)
+			return nil, err
+		}
+		keywords = append(keywords, keyword)
 	}
-	return tokens, nil
+	return keywords, nil
 }
 
-func (l *lexer) elementTokenize() (*Token, error) {
-	el := string(l.ch)
-	for i := 0; i < 6; i++ {
-		el += string(l.readChar())
-	}
-	if el == "ELEMENT" {
-		return &Token{
-			Type:    Element,
-			Literal: el,
-		}, nil
+// entityNames 宣言済みのパラメータ実体名を名前順に返す
+func (l *lexer) entityNames() []string {
+	names := make([]string, 0, len(l.entities))
+	for name := range l.entities {
+		names = append(names, name)
 	}
-	return nil, ErrElementTokenize
+	sort.Strings(names)
+	return names
 }
 
-func (l *lexer) nameTokenize() (*Token, error) {
-	name := string(l.ch)
+// ignoredSectionTokenize 読み飛ばす条件付きセクションの内容を ]]> の手前まで読む
+// IGNOREの中は入れ子の <![ と ]]> の対応だけを数え、宣言としては解釈しない
+func (l *lexer) ignoredSectionTokenize() (Token, error) {
+	nested := l.ignoring == Ignore
+	l.ignoring = Illegal
+	l.tokenStart = l.readPosition
+	l.tokenLineStart = l.lineStart
+	start := l.nextPosition()
+	depth := 0
 	for {
-		ch := l.peakChar()
-		if ch == WhiteSpaceSymbol || ch == WhiteSpaceTabSymbol || ch == WhiteSpaceCRSymbol || ch == WhiteSpaceLFSymbol || ch == CommaSymbol || ch == RightBracketSymbol || ch == AsteriskSymbol || ch == AmpersandSymbol || ch == VerticalLineSymbol || ch == PlusSymbol || ch == QuestionSymbol {
+		switch {
+		case l.hasPrefix(MarkedSectionEnd.Literal()) && depth == 0:
+			return Token{
+				Type:    IgnoredSection,
+				Literal: l.literal(start.Offset, l.readPosition),
+				Start:   start,
+				End:     l.nextPosition(),
+			}, nil
+		case l.hasPrefix(MarkedSectionEnd.Literal()):
+			depth--
+		case nested && l.hasPrefix(MarkedSectionStart.Literal()):
+			depth++
+		}
+		if l.readChar() == 0 && l.readPosition > l.end() {
 			break
 		}
-		name += string(ch)
+	}
+	// 閉じていない条件付きセクションの <![ を示す
+	sectionStart := start
+	if len(l.sections) > 0 {
+		sectionStart = l.sections[len(l.sections)-1]
+	}
+	err := &SyntaxError{
+		Err:      ErrMarkedSectionTokenize,
+		Pos:      sectionStart,
+		Text:     MarkedSectionStart.Literal(),
+		Expected: fmt.Sprintf("%q", MarkedSectionEnd.Literal()),
+	}
+	l.attachSource(err)
+	return Token{}, err
+}
+
+// findKeyword literalと同じ綴りの予約語を探す
+func findKeyword(literal string, keywords []TokenType) (TokenType, bool) {
+	for _, keyword := range keywords {
+		if literal == keyword.Literal() {
+			return keyword, true
+		}
+	}
+	return Illegal, false
+}
+
+// keywordList "A", "B" or "C" のような予約語の一覧
+func keywordList(keywords []TokenType) string {
+	quoted := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		quoted = append(quoted, fmt.Sprintf("%q", keyword.Literal()))
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// nameTokenize 名前を読む
+// NameStartCharから始まる場合はName、数字や . - などから始まる場合はNmtokenになる
+// https://www.w3.org/TR/xml/#NT-Name
+// https://www.w3.org/TR/xml/#NT-Nmtoken
+func (l *lexer) nameTokenize() (Token, error) {
+	start := l.position
+	tokenType := Name
+	if !isNameStartChar(l.ch) {
+		tokenType = NameToken
+	}
+	for isNameChar(l.peakChar()) {
 		l.readChar()
 	}
-	return &Token{
-		Type:    Name,
-		Literal: name,
+	return Token{
+		Type:    tokenType,
+		Literal: l.name(start, l.readPosition),
 	}, nil
 }
 
-func (l *lexer) emptyTokenize() (*Token, error) {
-	em := string(l.ch)
-	for i := 0; i < 4; i++ {
-		em += string(l.readChar())
+// peReferenceTokenize %name; のパラメータ実体参照を読み、実体名を返す
+// SGMLでは参照の直後が名前に使えない文字であれば ; を省略できる
+func (l *lexer) peReferenceTokenize() (Token, error) {
+	l.readChar()
+	name, err := l.nameTokenize()
+	if err != nil {
+		return Token{}, err
 	}
-	if em == "EMPTY" {
-		return &Token{
-			Type:    Empty,
-			Literal: em,
-		}, nil
+	if l.peakChar() == SemicolonSymbol {
+		l.readChar()
+	}
+	return Token{
+		Type:    PEReference,
+		Literal: name.Literal,
+	}, nil
+}
+
+// characterError 宣言の中に書けない文字のエラーを返す
+func (l *lexer) characterError() error {
+	err := l.syntaxError(ErrCharacterTokenize, l.currentPosition(), "")
+	// 全角の記号は対応する半角の記号の打ち間違いとして案内する
+	if ascii, ok := halfWidth(l.ch); ok {
+		err.Expected = fmt.Sprintf("%q instead of full-width %U", string(ascii), l.ch)
 	}
-	return nil, ErrEmptyTokenize
+	return err
 }
 
-func (l *lexer) attListTokenize() (*Token, error) {
-	att := string(l.ch)
-	for i := 0; i < 6; i++ {
-		att += string(l.readChar())
+// sharpKeywords #から始まる予約語
+var sharpKeywords = []TokenType{
+	PCData, DefaultValueImplied, DefaultValueRequired, DefaultValueFixed, DefaultValueCurrent, DefaultValueConRef, DefaultEntity,
+}
+
+// defaulValueTokenize #に続く名前全体を読み、#IMPLIEDなどの予約語として判定する
+// #IMPLIEDfoo のように予約語の後ろに名前が続く場合は、綴りを誤った場合と同じく失敗とする
+func (l *lexer) defaulValueTokenize() (Token, error) {
+	start := l.currentPosition()
+	for isNameChar(l.peakChar()) {
+		l.readChar()
 	}
-	if att == "ATTLIST" {
-		return &Token{
-			Type:    AttList,
-			Literal: att,
+	if keyword, ok := findKeyword(l.slice(start.Offset, l.readPosition), sharpKeywords); ok {
+		return Token{
+			Type:    keyword,
+			Literal: keyword.Literal(),
 		}, nil
 	}
-	return nil, ErrAttListTokenize
+	err := l.syntaxError(ErrDefaultValueTokenize, start, keywordList(sharpKeywords))
+	err.Suggestion = suggestKeyword(err.Text, sharpKeywords)
+	// 予約語の直後に空白を書き忘れた場合は、綴りが離れていてもその予約語を案内する
+	for _, keyword := range sharpKeywords {
+		if err.Suggestion == "" && strings.HasPrefix(err.Text, keyword.Literal()) {
+			err.Suggestion = keyword.Literal()
+		}
+	}
+	return Token{}, err
 }
 
-func (l *lexer) defaulValueTokenize() (*Token, error) {
-	switch l.peakChar() {
-	case 'I':
-		imp := string(l.readChar())
-		for i := 0; i < 6; i++ {
-			imp += string(l.readChar())
-		}
-		if imp == "IMPLIED" {
-			return &Token{
-				Type:    DefaultValueImplied,
-				Literal: "#IMPLIED",
+// stringTokenize 引用符で囲まれた文字列を読む
+// XMLのリテラルの規則に従い、文字参照は文字に置き換え、一般実体参照は実体名を記録してそのまま残す
+// 外部識別子の文字列は参照を解釈しない
+// https://www.w3.org/TR/xml/#sec-entexpand
+func (l *lexer) stringTokenize(quoteSymbol rune) (Token, error) {
+	start := l.currentPosition()
+	textStart := l.readPosition
+	// 文字参照を含む場合だけ置き換えた文字列を組み立てる
+	var text strings.Builder
+	decoded := false
+	segmentStart := textStart
+	var references, peReferences []string
+	for ch := l.readChar(); ch != 0; ch = l.readChar() {
+		if ch == quoteSymbol {
+			literal, source := "", ""
+			if decoded {
+				text.WriteString(l.slice(segmentStart, l.position))
+				literal = text.String()
+				source = l.literal(textStart, l.position)
+			} else {
+				literal = l.literal(textStart, l.position)
+			}
+			return Token{
+				Type:         String,
+				Literal:      literal,
+				References:   references,
+				PEReferences: peReferences,
+				Source:       source,
 			}, nil
 		}
-		return nil, ErrDefaultValueTokenize
-	case 'R':
-		req := string(l.readChar())
-		for i := 0; i < 7; i++ {
-			req += string(l.readChar())
+		// 実体の値の中のパラメータ実体参照は、実体を参照した時点で展開する
+		if ch == PercentSymbol && l.declaration == Entity && !l.externalID && isNameStartChar(l.peakChar()) {
+			ref, err := l.peReferenceTokenize()
+			if err != nil {
+				return Token{}, err
+			}
+			peReferences = append(peReferences, ref.Literal)
+			continue
 		}
-		if req == "REQUIRED" {
-			return &Token{
-				Type:    DefaultValueRequired,
-				Literal: "#REQUIRED",
-			}, nil
+		if ch != AmpersandSymbol || l.externalID {
+			continue
 		}
-		return nil, ErrDefaultValueTokenize
-	case 'F':
-		fix := string(l.readChar())
-		for i := 0; i < 4; i++ {
-			fix += string(l.readChar())
+		if l.peakChar() == SharpSymbol {
+			refStart := l.position
+			r, err := l.charReferenceTokenize()
+			if err != nil {
+				return Token{}, err
+			}
+			text.WriteString(l.slice(segmentStart, refStart))
+			text.WriteRune(r)
+			segmentStart = l.readPosition
+			decoded = true
+			continue
 		}
-		if fix == "FIXED" {
-			return &Token{
-				Type:    DefaultValueFixed,
-				Literal: "#FIXED",
-			}, nil
+		name, err := l.entityReferenceTokenize()
+		if err != nil {
+			return Token{}, err
 		}
-		return nil, ErrDefaultValueTokenize
-	default:
-		return nil, ErrDefaultValueTokenize
+		references = append(references, name)
 	}
+	// 入力の末尾まで読んでしまっているので開始の引用符だけを失敗箇所とする
+	err := l.syntaxError(ErrStringTokenize, start, fmt.Sprintf("closing %q", string(quoteSymbol)))
+	err.Text = string(quoteSymbol)
+	return Token{}, err
 }
 
-func (l *lexer) stringTokenize(quoteSymbol byte) (*Token, error) {
-	str := ""
+// charReferenceTokenize &#160; や &#xA0; の文字参照を読み、参照している文字を返す
+func (l *lexer) charReferenceTokenize() (rune, error) {
+	start := l.currentPosition()
+	l.readChar()
+	base, digits := 10, "decimal digits"
+	if l.peakChar() == 'x' {
+		l.readChar()
+		base, digits = 16, "hexadecimal digits"
+	}
+	value := 0
+	n := 0
+	for ; isDigit(l.peakChar(), base); n++ {
+		value = value*base + digitValue(l.readChar())
+		// 大きすぎる値で桁あふれしないよう、文字の範囲を超えた時点で打ち切る
+		if value > unicode.MaxRune {
+			value = unicode.MaxRune + 1
+		}
+	}
+	if n == 0 {
+		return 0, l.syntaxError(ErrReferenceTokenize, start, digits)
+	}
+	if l.peakChar() != SemicolonSymbol {
+		return 0, l.syntaxError(ErrReferenceTokenize, start, fmt.Sprintf("%q", Semicolon.Literal()))
+	}
+	l.readChar()
+	if !isChar(rune(value)) {
+		return 0, l.syntaxError(ErrReferenceTokenize, start, "reference to a legal character")
+	}
+	return rune(value), nil
+}
+
+// entityReferenceTokenize &name; の一般実体参照を読み、実体名を返す
+func (l *lexer) entityReferenceTokenize() (string, error) {
+	start := l.currentPosition()
+	if !isNameStartChar(l.peakChar()) {
+		return "", l.syntaxError(ErrReferenceTokenize, start, fmt.Sprintf("entity name or %q after %q", "#", Ampersand.Literal()))
+	}
+	nameStart := l.readPosition
+	for isNameChar(l.peakChar()) {
+		l.readChar()
+	}
+	name := l.name(nameStart, l.readPosition)
+	if l.peakChar() != SemicolonSymbol {
+		return "", l.syntaxError(ErrReferenceTokenize, start, fmt.Sprintf("%q", Semicolon.Literal()))
+	}
+	l.readChar()
+	return name, nil
+}
+
+// isDigit baseで指定した基数の数字かどうか
+func isDigit(r rune, base int) bool {
+	switch {
+	case '0' <= r && r <= '9':
+		return true
+	case base == 16 && (('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')):
+		return true
+	}
+	return false
+}
+
+// digitValue 16進数までの数字の値
+func digitValue(r rune) int {
+	switch {
+	case 'a' <= r && r <= 'f':
+		return int(r-'a') + 10
+	case 'A' <= r && r <= 'F':
+		return int(r-'A') + 10
+	}
+	return int(r - '0')
+}
+
+// processingInstructionTokenize <?target data?> の処理命令を読み、<? と ?> の間を返す
+// SGMLの処理命令は > で終わるので、?> がないまま次の < か入力の終わりに達した場合は最初の > までを処理命令とする
+func (l *lexer) processingInstructionTokenize() (Token, error) {
+	start := l.currentPosition()
+	l.readChar()
+	textStart := l.readPosition
+	var firstClose *cursor // 最初の > を読んだ時点の読み込み位置
+scan:
 	for ch := l.readChar(); ch != 0; ch = l.readChar() {
-		switch ch {
-		case quoteSymbol:
-			return &Token{
-				Type:    String,
-				Literal: str,
+		switch {
+		case ch == QuestionSymbol && l.peakChar() == RightAngleBracketSymbol:
+			end := l.position
+			l.readChar()
+			return Token{
+				Type:    ProcessingInstruction,
+				Literal: l.literal(textStart, end),
 			}, nil
-		default:
+		case ch == RightAngleBracketSymbol && firstClose == nil:
+			c := l.mark()
+			firstClose = &c
+		case ch == LeftAngleBracketSymbol && firstClose != nil:
+			break scan
 		}
-		str += string(ch)
 	}
-	return nil, ErrStringTokenize
+	if firstClose != nil {
+		l.restore(*firstClose)
+		return Token{
+			Type:    ProcessingInstruction,
+			Literal: l.literal(textStart, l.position),
+		}, nil
+	}
+	err := l.syntaxError(ErrProcessingInstructionTokenize, start, `"?>"`)
+	err.Text = "<?"
+	return Token{}, err
 }
 
-func (l *lexer) entityTokenize() (*Token, error) {
-	en := string(l.ch)
-	for i := 0; i < 5; i++ {
-		en += string(l.readChar())
+// textDeclClassify 処理命令がテキスト宣言であれば、以降の入力を指定された符号化方式で読む
+func (l *lexer) textDeclClassify(token Token) error {
+	target, data := splitProcessingInstruction(token.Literal)
+	if !strings.EqualFold(target, "xml") {
+		return nil
 	}
-	if en == "ENTITY" {
-		return &Token{
-			Type:    Entity,
-			Literal: en,
-		}, nil
+	syntaxErr := &SyntaxError{
+		Err:  ErrTextDeclTokenize,
+		Pos:  token.Start,
+		Text: "<?" + target,
+	}
+	if l.started {
+		syntaxErr.Expected = "text declaration at the beginning of the input"
+		l.attachSource(syntaxErr)
+		return syntaxErr
 	}
-	return nil, ErrEntityTokenize
+	_, encoding, err := parseTextDecl(data)
+	if err != nil {
+		syntaxErr.Expected = err.Error()
+		l.attachSource(syntaxErr)
+		return syntaxErr
+	}
+	if err := l.switchEncoding(encoding); err != nil {
+		syntaxErr.Expected = err.Error()
+		l.attachSource(syntaxErr)
+		return syntaxErr
+	}
+	return nil
 }
 
-func (l *lexer) readChar() byte {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+// switchEncoding 未読の入力をencodingからUTF-8に変換しながら読むようにする
+func (l *lexer) switchEncoding(encoding string) error {
+	// bufは以降の読み込みで書き換えるので、未読の部分はコピーしておく
+	var rest io.Reader = strings.NewReader(l.slice(l.readPosition, l.end()))
+	if l.reader != nil {
+		rest = io.MultiReader(rest, l.reader)
+	}
+	decoded, err := newCharsetReader(encoding, rest)
+	if err != nil || decoded == rest {
+		return err
+	}
+	if l.buf == nil {
+		// 文字列から読んでいた場合も以降はio.Readerから読む
+		l.buf = []byte(l.input[:l.readPosition-l.base])
+		l.input = ""
+		l.names = map[string]string{}
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.buf = l.buf[:l.readPosition-l.base]
+	}
+	l.reader = decoded
+	return nil
+}
+
+// commentTokenize <!-- と --> で囲まれたコメント宣言を読み、その中身を返す
+func (l *lexer) commentTokenize() (Token, error) {
+	start := l.currentPosition()
+	for i := 0; i < 3; i++ {
+		l.readChar()
+	}
+	textStart := l.readPosition
+	for ch := l.readChar(); ch != 0; ch = l.readChar() {
+		if ch == MinusSymbol && l.hasPrefix("->") {
+			comment := l.literal(textStart, l.position)
+			l.readChar()
+			l.readChar()
+			return Token{
+				Type:    Comment,
+				Literal: comment,
+			}, nil
+		}
+	}
+	err := l.syntaxError(ErrCommentTokenize, start, `"-->"`)
+	err.Text = "<!--"
+	return Token{}, err
+}
+
+// inlineCommentTokenize 宣言の中の -- と -- で囲まれたコメントを読み、その中身を返す
+func (l *lexer) inlineCommentTokenize() (Token, error) {
+	start := l.currentPosition()
+	l.readChar()
+	textStart := l.readPosition
+	for ch := l.readChar(); ch != 0; ch = l.readChar() {
+		if ch == MinusSymbol && l.peakChar() == MinusSymbol {
+			comment := l.literal(textStart, l.position)
+			l.readChar()
+			return Token{
+				Type:    Comment,
+				Literal: comment,
+			}, nil
+		}
+	}
+	err := l.syntaxError(ErrCommentTokenize, start, `"--"`)
+	err.Text = "--"
+	return Token{}, err
+}
+
+func (l *lexer) readChar() rune {
+	// 改行の次の文字から次の行として数える
+	if l.ch == WhiteSpaceLFSymbol {
+		l.line += 1
+		l.column = 0
+		l.lineStart = l.readPosition
 	}
+	l.column += 1
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.fill(utf8.UTFMax)
+	if l.readPosition >= l.end() {
+		l.ch = 0
+		l.readPosition += 1
+		return l.ch
+	}
+	// ほとんどの文字はASCIIなのでUTF-8の復号を省く
+	if b := l.byteAt(l.readPosition); b < utf8.RuneSelf {
+		l.ch = rune(b)
+		l.readPosition += 1
+		return l.ch
+	}
+	ch, size := l.decodeRune(l.readPosition)
+	l.ch = ch
+	l.readPosition += size
 	return l.ch
 }
 
-func (l *lexer) peakChar() byte {
+func (l *lexer) peakChar() rune {
 	// 入力が終わったらchを0に
-	if l.readPosition >= len(l.input) {
+	l.fill(utf8.UTFMax)
+	if l.readPosition >= l.end() {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	if b := l.byteAt(l.readPosition); b < utf8.RuneSelf {
+		return rune(b)
+	}
+	ch, _ := l.decodeRune(l.readPosition)
+	return ch
+}
+
+// peakNonSpaceChar 空白を読み飛ばした次の文字
+func (l *lexer) peakNonSpaceChar() byte {
+	for i := l.readPosition; l.fill(i - l.readPosition + 1); i++ {
+		switch ch := l.byteAt(i); ch {
+		case WhiteSpaceSymbol, WhiteSpaceTabSymbol, WhiteSpaceCRSymbol, WhiteSpaceLFSymbol:
+			continue
+		default:
+			return ch
+		}
+	}
+	return 0
+}
+
+// hasPrefix 次に読み込む文字からprefixが続くかどうか
+func (l *lexer) hasPrefix(prefix string) bool {
+	if !l.fill(len(prefix)) {
+		return false
+	}
+	start := l.readPosition - l.base
+	if l.buf != nil {
+		return string(l.buf[start:start+len(prefix)]) == prefix
+	}
+	return strings.HasPrefix(l.input[start:], prefix)
+}
+
+// end 読み込み済みの入力の末尾のバイト単位のインデックス
+func (l *lexer) end() int {
+	if l.buf != nil {
+		return l.base + len(l.buf)
+	}
+	return l.base + len(l.input)
+}
+
+// byteAt 読み込み済みの入力のiバイト目
+func (l *lexer) byteAt(i int) byte {
+	if l.buf != nil {
+		return l.buf[i-l.base]
+	}
+	return l.input[i-l.base]
+}
+
+// decodeRune 読み込み済みの入力のiバイト目から始まる文字とそのバイト数
+func (l *lexer) decodeRune(i int) (rune, int) {
+	if l.buf != nil {
+		return utf8.DecodeRune(l.buf[i-l.base:])
+	}
+	return utf8.DecodeRuneInString(l.input[i-l.base:])
+}
+
+// slice 読み込み済みの入力のfromからtoまでを切り出す
+// io.Readerから読む場合、bufは後で書き換えるのでコピーを返す
+func (l *lexer) slice(from, to int) string {
+	if l.buf != nil {
+		return string(l.buf[from-l.base : to-l.base])
+	}
+	return l.input[from-l.base : to-l.base]
+}
+
+// literal 読み込み済みの入力のfromからtoまでをトークンの文字列として切り出す
+func (l *lexer) literal(from, to int) string {
+	return l.slice(from, to)
+}
+
+// name literalと同じく名前を切り出す
+// 同じ名前は何度も現れるので、io.Readerから読む場合はコピーを1つにまとめる
+func (l *lexer) name(from, to int) string {
+	if l.buf == nil {
+		return l.slice(from, to)
+	}
+	if name, ok := l.names[string(l.buf[from-l.base:to-l.base])]; ok {
+		return name
+	}
+	name := l.literal(from, to)
+	l.names[name] = name
+	return name
+}
+
+// fill 未読の入力がnバイト以上になるまでreaderから読み込み、読み込めた場合はtrueを返す
+func (l *lexer) fill(n int) bool {
+	for l.reader != nil && l.readPosition+n > l.end() {
+		l.discard()
+		// 捨てられない長いトークンの途中でも、bufはappendで伸ばすので読み込みの合計は線形の時間で済む
+		n := len(l.buf)
+		if cap(l.buf)-n < readChunkSize {
+			l.buf = append(l.buf, make([]byte, readChunkSize)...)
+		}
+		size, err := l.reader.Read(l.buf[n : n+readChunkSize])
+		l.buf = l.buf[:n+size]
+		if err != nil {
+			if err != io.EOF {
+				l.readErr = err
+			}
+			l.reader = nil
+		}
+	}
+	return l.readPosition+n <= l.end()
+}
+
+// discard 字句解析を終えた入力を捨てる
+// エラー表示のため、読み込み中のトークンとその行の先頭(最大snippetContextバイト)は残す
+func (l *lexer) discard() {
+	keep := l.tokenStart - snippetContext
+	if keep < l.tokenLineStart {
+		keep = l.tokenLineStart
+	}
+	if l.trivia && keep > l.triviaStart {
+		keep = l.triviaStart
+	}
+	// 捨てる部分が残す部分より短いうちは詰めずに後ろへ読み足し、コピーの合計を入力の長さ程度に抑える
+	if discarded := keep - l.base; discarded > 0 && discarded >= len(l.buf)-discarded {
+		l.buf = l.buf[:copy(l.buf, l.buf[discarded:])]
+		l.base = keep
+	}
+}
+
+// currentPosition 検査中の文字の位置
+func (l *lexer) currentPosition() Position {
+	return Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+// nextPosition 検査中の文字の直後の位置
+func (l *lexer) nextPosition() Position {
+	offset := l.readPosition
+	if offset > l.end() {
+		offset = l.end()
+	}
+	return Position{Offset: offset, Line: l.line, Column: l.column + 1}
+}
+
+// syntaxError startから検査中の文字までを失敗箇所としたエラーを返す
+func (l *lexer) syntaxError(err error, start Position, expected string) *SyntaxError {
+	end := l.readPosition
+	if end > l.end() {
+		end = l.end()
+	}
+	syntaxErr := &SyntaxError{
+		Err:      err,
+		Pos:      start,
+		Text:     l.slice(start.Offset, end),
+		Expected: expected,
+	}
+	l.attachSource(syntaxErr)
+	return syntaxErr
+}
+
+// attachSource 失敗した行を表示できるよう、行末までの入力をエラーに持たせる
+func (l *lexer) attachSource(err *SyntaxError) {
+	for i := l.readPosition; l.fill(i-l.readPosition+1) && i-l.readPosition < snippetContext; i++ {
+		if l.byteAt(i) == WhiteSpaceLFSymbol {
+			break
+		}
+	}
+	err.source = l.slice(l.base, l.end())
+	err.sourceOffset = l.base
+}
+
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
 }
@@ -2,11 +2,21 @@ package main
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
+// ignorePosition トークンの種類と文字列だけを比較する
+var ignorePosition = cmpopts.IgnoreFields(Token{}, "Start", "End")
+
 func TestElementLexer(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -459,7 +469,7 @@ func TestElementLexer(t *testing.T) {
 					Literal: ")",
 				},
 				{
-					Type:    Plus,
+					Type:    Inclusion,
 					Literal: "+",
 				},
 				{
@@ -522,7 +532,7 @@ func TestElementLexer(t *testing.T) {
 					Literal: ")",
 				},
 				{
-					Type:    Minus,
+					Type:    Exclusion,
 					Literal: "-",
 				},
 				{
@@ -544,6 +554,84 @@ func TestElementLexer(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name:  "成功ケース_子要素が#PCDATA",
+			input: "<!ELEMENT name - - (#PCDATA)>",
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    Element,
+					Literal: "ELEMENT",
+				},
+				{
+					Type:    Name,
+					Literal: "name",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    LeftBracket,
+					Literal: "(",
+				},
+				{
+					Type:    PCData,
+					Literal: "#PCDATA",
+				},
+				{
+					Type:    RightBracket,
+					Literal: ")",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_子要素がANY",
+			input: "<!ELEMENT person ANY>",
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    Element,
+					Literal: "ELEMENT",
+				},
+				{
+					Type:    Name,
+					Literal: "person",
+				},
+				{
+					Type:    Any,
+					Literal: "ANY",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+			wantErr: nil,
+		},
 		{
 			name:    "ELEMENT要素名が間違っていてエラーが発生する",
 			input:   "<!ELEMINT person - O (name,age,license*）>",
@@ -558,7 +646,7 @@ func TestElementLexer(t *testing.T) {
 			if err != nil && !errors.Is(err, tt.wantErr) {
 				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
 			}
-			if diff := cmp.Diff(got, tt.want); diff != "" {
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
 				t.Errorf("mismatch (-got +want):\n%s", diff)
 			}
 		})
@@ -601,7 +689,7 @@ lang    NAME
 					Literal: "lang",
 				},
 				{
-					Type:    Name,
+					Type:    AttTypeName,
 					Literal: "NAME",
 				},
 				{
@@ -640,7 +728,7 @@ lang    NAME      #IMPLIED
 					Literal: "lang",
 				},
 				{
-					Type:    Name,
+					Type:    AttTypeName,
 					Literal: "NAME",
 				},
 				{
@@ -683,7 +771,7 @@ version CDATA     #FIXED   '-//W3C//DTD HTML 4.01 Transitional//EN'
 					Literal: "version",
 				},
 				{
-					Type:    Name,
+					Type:    CData,
 					Literal: "CDATA",
 				},
 				{
@@ -731,7 +819,7 @@ lang    NAME      #IMPLIED
 					Literal: "lang",
 				},
 				{
-					Type:    Name,
+					Type:    AttTypeName,
 					Literal: "NAME",
 				},
 				{
@@ -743,7 +831,7 @@ lang    NAME      #IMPLIED
 					Literal: "lang",
 				},
 				{
-					Type:    Name,
+					Type:    AttTypeName,
 					Literal: "NAME",
 				},
 				{
@@ -765,7 +853,7 @@ lang    NAME      #IMPLIED
 			if err != nil && !errors.Is(err, tt.wantErr) {
 				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
 			}
-			if diff := cmp.Diff(got, tt.want); diff != "" {
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
 				t.Errorf("mismatch (-got +want):\n%s", diff)
 			}
 		})
@@ -821,9 +909,1588 @@ func TestEntityLexer(t *testing.T) {
 			if err != nil && !errors.Is(err, tt.wantErr) {
 				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
 			}
-			if diff := cmp.Diff(got, tt.want); diff != "" {
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPEReferenceLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_内容モデル",
+			input: `<!ELEMENT %heading; - - (%inline;)*>`,
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    Element,
+					Literal: "ELEMENT",
+				},
+				{
+					Type:    PEReference,
+					Literal: "heading",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    LeftBracket,
+					Literal: "(",
+				},
+				{
+					Type:    PEReference,
+					Literal: "inline",
+				},
+				{
+					Type:    RightBracket,
+					Literal: ")",
+				},
+				{
+					Type:    Asterisk,
+					Literal: "*",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+		},
+		{
+			name:  "成功ケース_属性定義",
+			input: `<!ATTLIST A %attrs; charset %Charset; #IMPLIED>`,
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    AttList,
+					Literal: "ATTLIST",
+				},
+				{
+					Type:    Name,
+					Literal: "A",
+				},
+				{
+					Type:    PEReference,
+					Literal: "attrs",
+				},
+				{
+					Type:    Name,
+					Literal: "charset",
+				},
+				{
+					Type:    PEReference,
+					Literal: "Charset",
+				},
+				{
+					Type:    DefaultValueImplied,
+					Literal: "#IMPLIED",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+		},
+		{
+			name:  "成功ケース_実体の値の中の参照は展開するまでそのまま残す",
+			input: `<!ENTITY % attrs "%coreattrs; %i18n;">`,
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    Entity,
+					Literal: "ENTITY",
+				},
+				{
+					Type:    Percent,
+					Literal: "%",
+				},
+				{
+					Type:    Name,
+					Literal: "attrs",
+				},
+				{
+					Type:         String,
+					Literal:      "%coreattrs; %i18n;",
+					PEReferences: []string{"coreattrs", "i18n"},
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+		},
+		{
+			name:  "成功ケース_参照の終わりの;を省略する",
+			input: `<!ELEMENT P - O (%inline)*>`,
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    Element,
+					Literal: "ELEMENT",
+				},
+				{
+					Type:    Name,
+					Literal: "P",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    TagUnNeed,
+					Literal: "O",
+				},
+				{
+					Type:    LeftBracket,
+					Literal: "(",
+				},
+				{
+					Type:    PEReference,
+					Literal: "inline",
+				},
+				{
+					Type:    RightBracket,
+					Literal: ")",
+				},
+				{
+					Type:    Asterisk,
+					Literal: "*",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
 				t.Errorf("mismatch (-got +want):\n%s", diff)
 			}
 		})
 	}
 }
+
+func TestMarkedSectionLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_INCLUDE",
+			input: "<![ INCLUDE [<!ELEMENT a - O EMPTY>]]>",
+			want: []Token{
+				{Type: MarkedSectionStart, Literal: "<!["},
+				{Type: Include, Literal: "INCLUDE"},
+				{Type: LeftSquareBracket, Literal: "["},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "a"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: TagUnNeed, Literal: "O"},
+				{Type: Empty, Literal: "EMPTY"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: MarkedSectionEnd, Literal: "]]>"},
+			},
+		},
+		{
+			name:  "成功ケース_IGNOREの中は入れ子の対応だけを数えて読み飛ばす",
+			input: "<![IGNORE[ <!ELEMINT <![ INCLUDE [ ]]> ]]>",
+			want: []Token{
+				{Type: MarkedSectionStart, Literal: "<!["},
+				{Type: Ignore, Literal: "IGNORE"},
+				{Type: LeftSquareBracket, Literal: "["},
+				{Type: IgnoredSection, Literal: " <!ELEMINT <![ INCLUDE [ ]]> "},
+				{Type: MarkedSectionEnd, Literal: "]]>"},
+			},
+		},
+		{
+			name:  "成功ケース_パラメータ実体で予約語を指定する",
+			input: `<!ENTITY % reserved "IGNORE"><!ENTITY % frameset "%reserved;"><![ %frameset; [<!ELEMENT a>]]>`,
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Percent, Literal: "%"},
+				{Type: Name, Literal: "reserved"},
+				{Type: String, Literal: "IGNORE"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Percent, Literal: "%"},
+				{Type: Name, Literal: "frameset"},
+				{Type: String, Literal: "%reserved;", PEReferences: []string{"reserved"}},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: MarkedSectionStart, Literal: "<!["},
+				{Type: PEReference, Literal: "frameset"},
+				{Type: LeftSquareBracket, Literal: "["},
+				{Type: IgnoredSection, Literal: "<!ELEMENT a>"},
+				{Type: MarkedSectionEnd, Literal: "]]>"},
+			},
+		},
+		{
+			name:  "成功ケース_IGNOREはINCLUDEより優先する",
+			input: "<![ INCLUDE TEMP IGNORE [x]]>",
+			want: []Token{
+				{Type: MarkedSectionStart, Literal: "<!["},
+				{Type: Include, Literal: "INCLUDE"},
+				{Type: Temp, Literal: "TEMP"},
+				{Type: Ignore, Literal: "IGNORE"},
+				{Type: LeftSquareBracket, Literal: "["},
+				{Type: IgnoredSection, Literal: "x"},
+				{Type: MarkedSectionEnd, Literal: "]]>"},
+			},
+		},
+		{
+			name:    "存在しない予約語でエラーが発生する",
+			input:   "<![ EXCLUDE [ ]]>",
+			want:    nil,
+			wantErr: ErrMarkedSectionTokenize,
+		},
+		{
+			name:    "宣言されていないパラメータ実体でエラーが発生する",
+			input:   "<![ %HTML.Reserved; [ ]]>",
+			want:    nil,
+			wantErr: ErrMarkedSectionTokenize,
+		},
+		{
+			name:    "自分自身を参照するパラメータ実体でエラーが発生する",
+			input:   `<!ENTITY % a "%a;"><![ %a; [ ]]>`,
+			want:    nil,
+			wantErr: ErrMarkedSectionTokenize,
+		},
+		{
+			name:    "閉じられていないIGNOREでエラーが発生する",
+			input:   "<![ IGNORE [ <![ IGNORE [ ]]>",
+			want:    nil,
+			wantErr: ErrMarkedSectionTokenize,
+		},
+		{
+			name:    "[がないまま閉じた条件付きセクションでエラーが発生する",
+			input:   "<![ IGNORE ]]>[",
+			want:    nil,
+			wantErr: ErrMarkedSectionTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessingInstructionLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_テキスト宣言と処理命令",
+			input: "\uFEFF<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<?page break?><!ENTITY a 'b'>",
+			want: []Token{
+				{Type: ProcessingInstruction, Literal: `xml version="1.0" encoding="UTF-8"`},
+				{Type: ProcessingInstruction, Literal: "page break"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "a"},
+				{Type: String, Literal: "b"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:  "成功ケース_ISO-8859-1で符号化された入力",
+			input: "<?xml encoding='ISO-8859-1'?><!ENTITY eacute '\xe9'>",
+			want: []Token{
+				{Type: ProcessingInstruction, Literal: "xml encoding='ISO-8859-1'"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "eacute"},
+				{Type: String, Literal: "é"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:  "成功ケース_SGMLの処理命令",
+			input: "<?NewPage>",
+			want: []Token{
+				{Type: ProcessingInstruction, Literal: "NewPage"},
+			},
+		},
+		{
+			name:  "成功ケース_処理命令の中の>",
+			input: "<?app if a > b then c?><!ENTITY a 'b'>",
+			want: []Token{
+				{Type: ProcessingInstruction, Literal: "app if a > b then c"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "a"},
+				{Type: String, Literal: "b"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:  "成功ケース_?>より前に次の宣言があるSGMLの処理命令",
+			input: "<?NewPage>\n<!ENTITY a 'b'><?page?>",
+			want: []Token{
+				{Type: ProcessingInstruction, Literal: "NewPage"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "a"},
+				{Type: String, Literal: "b"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: ProcessingInstruction, Literal: "page"},
+			},
+		},
+		{
+			name:    "先頭以外のテキスト宣言でエラーが発生する",
+			input:   "<!ENTITY a 'b'><?xml version='1.0'?>",
+			want:    nil,
+			wantErr: ErrTextDeclTokenize,
+		},
+		{
+			name:    "対応していない符号化方式でエラーが発生する",
+			input:   "<?xml encoding='Shift_JIS'?>",
+			want:    nil,
+			wantErr: ErrTextDeclTokenize,
+		},
+		{
+			name:    "テキスト宣言の書式が間違っていてエラーが発生する",
+			input:   "<?xml version=1.0?>",
+			want:    nil,
+			wantErr: ErrTextDeclTokenize,
+		},
+		{
+			name:    "閉じられていない処理命令でエラーが発生する",
+			input:   "<?page break",
+			want:    nil,
+			wantErr: ErrProcessingInstructionTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			// 1バイトずつ読んでも同じように符号化方式を切り替える
+			got, err = NewReaderLexer(iotest.OneByteReader(strings.NewReader(tt.input))).Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("reader error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("reader mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKeywordLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_予約語の頭文字で始まる要素名",
+			input: "<!ELEMENT OL - O (OPTION|EM|ABBR|ADDRESS|O|EMPTY)+>",
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "OL"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: TagUnNeed, Literal: "O"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "OPTION"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "EM"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "ABBR"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "ADDRESS"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "O"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "EMPTY"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Plus, Literal: "+"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_予約語と同じ名前の要素と属性",
+			input: "<!ELEMENT EMPTY O O EMPTY><!ATTLIST ENTITY ELEMENT CDATA #IMPLIED>",
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "EMPTY"},
+				{Type: TagUnNeed, Literal: "O"},
+				{Type: TagUnNeed, Literal: "O"},
+				{Type: Empty, Literal: "EMPTY"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: AttList, Literal: "ATTLIST"},
+				{Type: Name, Literal: "ENTITY"},
+				{Type: Name, Literal: "ELEMENT"},
+				{Type: CData, Literal: "CDATA"},
+				{Type: DefaultValueImplied, Literal: "#IMPLIED"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_名前グループの後のタグ省略指定",
+			input: "<!ELEMENT (SUB|%phrase;) - - (%inline;)*>",
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "SUB"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: PEReference, Literal: "phrase"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: PEReference, Literal: "inline"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Asterisk, Literal: "*"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_タグ省略指定と出現回数と例外",
+			input: "<!ELEMENT a O O (b)+ +(c) -(d)><!ELEMENT e - - (f)+(g)>",
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "a"},
+				{Type: TagUnNeed, Literal: "O"},
+				{Type: TagUnNeed, Literal: "O"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "b"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Plus, Literal: "+"},
+				{Type: Inclusion, Literal: "+"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "c"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Exclusion, Literal: "-"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "d"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "e"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "f"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Inclusion, Literal: "+"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "g"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_タグ省略指定のない例外",
+			input: "<!ELEMENT a (b) -(c)>",
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "a"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "b"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Exclusion, Literal: "-"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "c"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_属性の型と既定値",
+			input: `<!ATTLIST a ID ID #REQUIRED n NUMBER #CURRENT t NOTATION (gif|NAME) #CONREF x NMTOKEN ID>`,
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: AttList, Literal: "ATTLIST"},
+				{Type: Name, Literal: "a"},
+				{Type: Name, Literal: "ID"},
+				{Type: AttTypeID, Literal: "ID"},
+				{Type: DefaultValueRequired, Literal: "#REQUIRED"},
+				{Type: Name, Literal: "n"},
+				{Type: AttTypeNumber, Literal: "NUMBER"},
+				{Type: DefaultValueCurrent, Literal: "#CURRENT"},
+				{Type: Name, Literal: "t"},
+				{Type: Notation, Literal: "NOTATION"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "gif"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "NAME"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: DefaultValueConRef, Literal: "#CONREF"},
+				{Type: Name, Literal: "x"},
+				{Type: AttTypeNMToken, Literal: "NMTOKEN"},
+				{Type: Name, Literal: "ID"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:  "成功ケース_実体の種類と外部識別子",
+			input: `<!ENTITY % SYSTEM PUBLIC "-//x" "x.dtd"><!ENTITY logo SYSTEM "logo.gif" NDATA CDATA><!ENTITY #DEFAULT SDATA "?"><!NOTATION gif PUBLIC "-//gif">`,
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Percent, Literal: "%"},
+				{Type: Name, Literal: "SYSTEM"},
+				{Type: Public, Literal: "PUBLIC"},
+				{Type: String, Literal: "-//x"},
+				{Type: String, Literal: "x.dtd"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "logo"},
+				{Type: System, Literal: "SYSTEM"},
+				{Type: String, Literal: "logo.gif"},
+				{Type: NData, Literal: "NDATA"},
+				{Type: Name, Literal: "CDATA"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: DefaultEntity, Literal: "#DEFAULT"},
+				{Type: EntityTypeSData, Literal: "SDATA"},
+				{Type: String, Literal: "?"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Notation, Literal: "NOTATION"},
+				{Type: Name, Literal: "gif"},
+				{Type: Public, Literal: "PUBLIC"},
+				{Type: String, Literal: "-//gif"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:  "成功ケース_宣言内容",
+			input: `<!ELEMENT RCDATA - - RCDATA>`,
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "RCDATA"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: RCData, Literal: "RCDATA"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:    "ATTLISTの綴りが間違っていてエラーが発生する",
+			input:   "<!ATTLST a b CDATA #IMPLIED>",
+			want:    nil,
+			wantErr: ErrAttListTokenize,
+		},
+		{
+			name:    "存在しない宣言でエラーが発生する",
+			input:   "<!FOO a>",
+			want:    nil,
+			wantErr: ErrDeclarationTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNameLexer(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Token
+	}{
+		{
+			name:  "成功ケース_閉じ山括弧の直前の名前",
+			input: `person>`,
+			want: []Token{
+				{Type: Name, Literal: "person"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:  "成功ケース_括弧と引用符に隣接する名前",
+			input: `(name)"value"`,
+			want: []Token{
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "name"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: String, Literal: "value"},
+			},
+		},
+		{
+			name:  "成功ケース_セミコロンで区切られたパラメータ実体参照",
+			input: `%a.b-c;d`,
+			want: []Token{
+				{Type: PEReference, Literal: "a.b-c"},
+				{Type: Name, Literal: "d"},
+			},
+		},
+		{
+			name:  "成功ケース_名前に使える記号と数字",
+			input: `h1 xml:lang _id a.b-c a·b`,
+			want: []Token{
+				{Type: Name, Literal: "h1"},
+				{Type: Name, Literal: "xml:lang"},
+				{Type: Name, Literal: "_id"},
+				{Type: Name, Literal: "a.b-c"},
+				{Type: Name, Literal: "a·b"},
+			},
+		},
+		{
+			name:  "成功ケース_名前トークン",
+			input: `(1|2.5|-1|.5|a)`,
+			want: []Token{
+				{Type: LeftBracket, Literal: "("},
+				{Type: NameToken, Literal: "1"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: NameToken, Literal: "2.5"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: NameToken, Literal: "-1"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: NameToken, Literal: ".5"},
+				{Type: VerticalLine, Literal: "|"},
+				{Type: Name, Literal: "a"},
+				{Type: RightBracket, Literal: ")"},
+			},
+		},
+		{
+			name:  "成功ケース_除外例外の - は名前トークンにならない",
+			input: `-(a) - O`,
+			want: []Token{
+				{Type: Minus, Literal: "-"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "a"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: Minus, Literal: "-"},
+				{Type: Name, Literal: "O"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReferenceLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_文字参照",
+			input: `"a&#160;b&#x3C;"`,
+			want: []Token{
+				{Type: String, Literal: "a\u00a0b<", Source: "a&#160;b&#x3C;"},
+			},
+		},
+		{
+			name:  "成功ケース_一般実体参照はそのまま残す",
+			input: `'&amp;&#38;&nbsp;'`,
+			want: []Token{
+				{Type: String, Literal: "&amp;&&nbsp;", References: []string{"amp", "nbsp"}, Source: "&amp;&#38;&nbsp;"},
+			},
+		},
+		{
+			name:  "成功ケース_外部識別子の参照は解釈しない",
+			input: `<!ENTITY a PUBLIC "-//A//&#38;" "a?b=1&c=2"><!ENTITY b "&#38;">`,
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "a"},
+				{Type: Public, Literal: "PUBLIC"},
+				{Type: String, Literal: "-//A//&#38;"},
+				{Type: String, Literal: "a?b=1&c=2"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Entity, Literal: "ENTITY"},
+				{Type: Name, Literal: "b"},
+				{Type: String, Literal: "&", Source: "&#38;"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+		},
+		{
+			name:    "数字のない文字参照でエラーが発生する",
+			input:   `"&#x;"`,
+			want:    nil,
+			wantErr: ErrReferenceTokenize,
+		},
+		{
+			name:    "大文字の X の文字参照でエラーが発生する",
+			input:   `"&#X3C;"`,
+			want:    nil,
+			wantErr: ErrReferenceTokenize,
+		},
+		{
+			name:    "文字参照の ; がなくエラーが発生する",
+			input:   `"&#38 "`,
+			want:    nil,
+			wantErr: ErrReferenceTokenize,
+		},
+		{
+			name:    "文書に書けない文字の参照でエラーが発生する",
+			input:   `"&#xFFFE;&#99999999999;"`,
+			want:    nil,
+			wantErr: ErrReferenceTokenize,
+		},
+		{
+			name:    "実体名のない参照でエラーが発生する",
+			input:   `"a & b"`,
+			want:    nil,
+			wantErr: ErrReferenceTokenize,
+		},
+		{
+			name:    "一般実体参照の ; がなくエラーが発生する",
+			input:   `"&amp b"`,
+			want:    nil,
+			wantErr: ErrReferenceTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnicodeLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_マルチバイト文字の要素名と文字列",
+			input: "<!ELEMENT 人物 - - (名前,年齢)><!ATTLIST 人物 説明 CDATA \"ルート要素\">",
+			want: []Token{
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: Element, Literal: "ELEMENT"},
+				{Type: Name, Literal: "人物"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: TagNeed, Literal: "-"},
+				{Type: LeftBracket, Literal: "("},
+				{Type: Name, Literal: "名前"},
+				{Type: Comma, Literal: ","},
+				{Type: Name, Literal: "年齢"},
+				{Type: RightBracket, Literal: ")"},
+				{Type: RightAngleBracket, Literal: ">"},
+				{Type: LeftAngleBracket, Literal: "<"},
+				{Type: Exclamation, Literal: "!"},
+				{Type: AttList, Literal: "ATTLIST"},
+				{Type: Name, Literal: "人物"},
+				{Type: Name, Literal: "説明"},
+				{Type: CData, Literal: "CDATA"},
+				{Type: String, Literal: "ルート要素"},
+				{Type: RightAngleBracket, Literal: ">"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "全角の括弧でエラーが発生する",
+			input:   "<!ELEMENT person - - (name,age,license*）>",
+			want:    nil,
+			wantErr: ErrCharacterTokenize,
+		},
+		{
+			name:    "不正なUTF-8でエラーが発生する",
+			input:   "<!ELEMENT \xff - - EMPTY>",
+			want:    nil,
+			wantErr: ErrCharacterTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommentLexer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_コメントのみ",
+			input: "<!-- person要素がルート要素となる -->",
+			want: []Token{
+				{
+					Type:    Comment,
+					Literal: " person要素がルート要素となる ",
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "成功ケース_コメントと宣言",
+			input: `<!-- 子要素の
+パターン -->
+<!ELEMENT person - - EMPTY>`,
+			want: []Token{
+				{
+					Type:    Comment,
+					Literal: " 子要素の\nパターン ",
+				},
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    Element,
+					Literal: "ELEMENT",
+				},
+				{
+					Type:    Name,
+					Literal: "person",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    TagNeed,
+					Literal: "-",
+				},
+				{
+					Type:    Empty,
+					Literal: "EMPTY",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "成功ケース_宣言の中のコメント",
+			input: "<!ATTLIST a href CDATA #IMPLIED -- URI for linked resource -->",
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+				},
+				{
+					Type:    AttList,
+					Literal: "ATTLIST",
+				},
+				{
+					Type:    Name,
+					Literal: "a",
+				},
+				{
+					Type:    Name,
+					Literal: "href",
+				},
+				{
+					Type:    CData,
+					Literal: "CDATA",
+				},
+				{
+					Type:    DefaultValueImplied,
+					Literal: "#IMPLIED",
+				},
+				{
+					Type:    Comment,
+					Literal: " URI for linked resource ",
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "宣言の中のコメントが閉じられておらずエラーが発生する",
+			input:   "<!ELEMENT a - - EMPTY -- anchor >",
+			want:    nil,
+			wantErr: ErrCommentTokenize,
+		},
+		{
+			name:    "コメントが閉じられておらずエラーが発生する",
+			input:   "<!-- person要素がルート要素となる ->",
+			want:    nil,
+			wantErr: ErrCommentTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if err != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignorePosition); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_複数行",
+			input: "<!ENTITY % a\n  'b c'>",
+			want: []Token{
+				{
+					Type:    LeftAngleBracket,
+					Literal: "<",
+					Start:   Position{Offset: 0, Line: 1, Column: 1},
+					End:     Position{Offset: 1, Line: 1, Column: 2},
+				},
+				{
+					Type:    Exclamation,
+					Literal: "!",
+					Start:   Position{Offset: 1, Line: 1, Column: 2},
+					End:     Position{Offset: 2, Line: 1, Column: 3},
+				},
+				{
+					Type:    Entity,
+					Literal: "ENTITY",
+					Start:   Position{Offset: 2, Line: 1, Column: 3},
+					End:     Position{Offset: 8, Line: 1, Column: 9},
+				},
+				{
+					Type:    Percent,
+					Literal: "%",
+					Start:   Position{Offset: 9, Line: 1, Column: 10},
+					End:     Position{Offset: 10, Line: 1, Column: 11},
+				},
+				{
+					Type:    Name,
+					Literal: "a",
+					Start:   Position{Offset: 11, Line: 1, Column: 12},
+					End:     Position{Offset: 12, Line: 1, Column: 13},
+				},
+				{
+					Type:    String,
+					Literal: "b c",
+					Start:   Position{Offset: 15, Line: 2, Column: 3},
+					End:     Position{Offset: 20, Line: 2, Column: 8},
+				},
+				{
+					Type:    RightAngleBracket,
+					Literal: ">",
+					Start:   Position{Offset: 20, Line: 2, Column: 8},
+					End:     Position{Offset: 21, Line: 2, Column: 9},
+				},
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			got, err := sut.Execute()
+			if err != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantMessage string
+		wantSnippet string
+		wantErr     error
+	}{
+		{
+			name:        "ELEMENT要素名が間違っている",
+			input:       "<!ELEMENT a - - EMPTY>\n<!ELEMINT b - - EMPTY>",
+			wantMessage: `2:3: failed to element tokenize: ELEMINT: did you mean ELEMENT?`,
+			wantSnippet: "<!ELEMINT b - - EMPTY>\n  ^~~~~~~",
+			wantErr:     ErrElementTokenize,
+		},
+		{
+			name:        "閉じられていない文字列",
+			input:       "<!ENTITY a\n\t'b>",
+			wantMessage: `2:2: failed to string tokenize: found "'", expected closing "'"`,
+			wantSnippet: "\t'b>\n\t^",
+			wantErr:     ErrStringTokenize,
+		},
+		{
+			name:        "全角の括弧",
+			input:       "<!ELEMENT 人物 - - (名前,年齢）>",
+			wantMessage: `1:24: failed to character tokenize: found "）", expected ")" instead of full-width U+FF09`,
+			wantSnippet: "<!ELEMENT 人物 - - (名前,年齢）>\n                             ^~",
+			wantErr:     ErrCharacterTokenize,
+		},
+		{
+			name:        "既定値の指定が間違っている",
+			input:       "<!ATTLIST a b CDATA #IMPLID>",
+			wantMessage: `1:21: failed to default value tokenize: #IMPLID: did you mean #IMPLIED?`,
+			wantSnippet: "<!ATTLIST a b CDATA #IMPLID>\n                    ^~~~~~~",
+			wantErr:     ErrDefaultValueTokenize,
+		},
+		{
+			name:        "既定値の予約語の後ろに名前が続く",
+			input:       "<!ATTLIST a b CDATA #IMPLIEDfoo>",
+			wantMessage: `1:21: failed to default value tokenize: #IMPLIEDfoo: did you mean #IMPLIED?`,
+			wantSnippet: "<!ATTLIST a b CDATA #IMPLIEDfoo>\n                    ^~~~~~~~~~~",
+			wantErr:     ErrDefaultValueTokenize,
+		},
+		{
+			name:        "#PCDATAの後ろに名前が続く",
+			input:       "<!ELEMENT p - O (#PCDATAX)>",
+			wantMessage: `1:18: failed to default value tokenize: #PCDATAX: did you mean #PCDATA?`,
+			wantSnippet: "<!ELEMENT p - O (#PCDATAX)>\n                 ^~~~~~~~",
+			wantErr:     ErrDefaultValueTokenize,
+		},
+		{
+			name:        "小文字で書いた予約語",
+			input:       "<!attlist a b CDATA #IMPLIED>",
+			wantMessage: `1:3: failed to attlist tokenize: attlist: did you mean ATTLIST?`,
+			wantSnippet: "<!attlist a b CDATA #IMPLIED>\n  ^~~~~~~",
+			wantErr:     ErrAttListTokenize,
+		},
+		{
+			name:        "綴りの近い予約語がない",
+			input:       "<!FOO a>",
+			wantMessage: `1:3: failed to declaration tokenize: found "FOO", expected "ELEMENT", "ATTLIST", "ENTITY", "NOTATION", "SHORTREF" or "USEMAP"`,
+			wantSnippet: "<!FOO a>\n  ^~~",
+			wantErr:     ErrDeclarationTokenize,
+		},
+		{
+			name:        "条件付きセクションの予約語が間違っている",
+			input:       "<![ INCLUD [ ]]>",
+			wantMessage: `1:5: failed to marked section tokenize: INCLUD: did you mean INCLUDE?`,
+			wantSnippet: "<![ INCLUD [ ]]>\n    ^~~~~~",
+			wantErr:     ErrMarkedSectionTokenize,
+		},
+		{
+			name:        "宣言されていないパラメータ実体の参照",
+			input:       "<!ENTITY % draft 'IGNORE'>\n<![ %drat; [ ]]>",
+			wantMessage: `2:5: failed to marked section tokenize: %drat;: did you mean %draft;?`,
+			wantSnippet: "<![ %drat; [ ]]>\n    ^~~~~~",
+			wantErr:     ErrMarkedSectionTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			_, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("error is not SyntaxError: %v", err)
+			}
+			if diff := cmp.Diff(syntaxErr.Error(), tt.wantMessage); diff != "" {
+				t.Errorf("message mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(syntaxErr.Snippet(), tt.wantSnippet); diff != "" {
+				t.Errorf("snippet mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLexerRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     []string
+		wantErrs []error
+	}{
+		{
+			name:  "成功ケース_エラーがない",
+			input: "<!ELEMENT a - O EMPTY>",
+			want:  []string{"<", "!", "ELEMENT", "a", "-", "O", "EMPTY", ">"},
+		},
+		{
+			name:     "次の宣言から再開する",
+			input:    "<!ELEMINT a - O EMPTY>\n<!ATTLIST b c CDATA #IMPLID>\n<!ELEMENT d - O EMPTY>",
+			want:     []string{"<", "!", "<", "!", "ATTLIST", "b", "c", "CDATA", "<", "!", "ELEMENT", "d", "-", "O", "EMPTY", ">"},
+			wantErrs: []error{ErrElementTokenize, ErrDefaultValueTokenize},
+		},
+		{
+			name:     "閉じられていない文字列の後の宣言から再開する",
+			input:    "<!ENTITY a 'b>\n<!ENTITY c \"d\">",
+			want:     []string{"<", "!", "ENTITY", "a", "<", "!", "ENTITY", "c", "d", ">"},
+			wantErrs: []error{ErrStringTokenize},
+		},
+		{
+			name:     "宣言の外の文字を読み飛ばす",
+			input:    "（）<!ELEMENT a - O EMPTY>",
+			want:     []string{"<", "!", "ELEMENT", "a", "-", "O", "EMPTY", ">"},
+			wantErrs: []error{ErrCharacterTokenize},
+		},
+		{
+			name:     "[がないまま閉じた条件付きセクションの後の宣言から再開する",
+			input:    "<![ IGNORE ]]>[<!ELEMENT a - O EMPTY>",
+			want:     []string{"<![", "IGNORE", "<", "!", "ELEMENT", "a", "-", "O", "EMPTY", ">"},
+			wantErrs: []error{ErrMarkedSectionTokenize},
+		},
+		{
+			name:     "次の宣言がなければ入力の末尾で終わる",
+			input:    "<!ELEMENT a - O (b）>",
+			want:     []string{"<", "!", "ELEMENT", "a", "-", "O", "(", "b"},
+			wantErrs: []error{ErrCharacterTokenize},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewLexer(tt.input)
+			tokens, errs := sut.ExecuteAll()
+			got := []string{}
+			for _, token := range tokens {
+				got = append(got, token.Literal)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("errors mismatch want: %v, but got %v", tt.wantErrs, errs)
+			}
+			for i, err := range errs {
+				if !errors.Is(err, tt.wantErrs[i]) {
+					t.Errorf("error mismatch want: %v, but got %v", tt.wantErrs[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestTriviaLexer(t *testing.T) {
+	input := "\uFEFF<!ENTITY % draft 'INCLUDE'><!-- 人物 -->\r\n<!ELEMENT person - O (name) -- 名前 -->  \n<![ %draft; [ <!ELEMENT a - O EMPTY> ]]>\n"
+	want := []Token{
+		{Type: LeftAngleBracket, Literal: "<", Leading: "\uFEFF", Raw: "<"},
+		{Type: Exclamation, Literal: "!", Raw: "!"},
+		{Type: Entity, Literal: "ENTITY", Raw: "ENTITY", Trailing: " "},
+		{Type: Percent, Literal: "%", Raw: "%", Trailing: " "},
+		{Type: Name, Literal: "draft", Raw: "draft", Trailing: " "},
+		{Type: String, Literal: "INCLUDE", Raw: "'INCLUDE'"},
+		{Type: RightAngleBracket, Literal: ">", Raw: ">"},
+		{Type: LeftAngleBracket, Literal: "<", Leading: "<!-- 人物 -->\r\n", Raw: "<"},
+		{Type: Exclamation, Literal: "!", Raw: "!"},
+		{Type: Element, Literal: "ELEMENT", Raw: "ELEMENT", Trailing: " "},
+		{Type: Name, Literal: "person", Raw: "person", Trailing: " "},
+		{Type: TagNeed, Literal: "-", Raw: "-", Trailing: " "},
+		{Type: TagUnNeed, Literal: "O", Raw: "O", Trailing: " "},
+		{Type: LeftBracket, Literal: "(", Raw: "("},
+		{Type: Name, Literal: "name", Raw: "name"},
+		{Type: RightBracket, Literal: ")", Raw: ")", Trailing: " "},
+		{Type: RightAngleBracket, Literal: ">", Leading: "-- 名前 --", Raw: ">", Trailing: "  "},
+		{Type: MarkedSectionStart, Literal: "<![", Leading: "\n", Raw: "<![", Trailing: " "},
+		{Type: PEReference, Literal: "draft", Raw: "%draft;", Trailing: " "},
+		{Type: LeftSquareBracket, Literal: "[", Raw: "[", Trailing: " "},
+		{Type: LeftAngleBracket, Literal: "<", Raw: "<"},
+		{Type: Exclamation, Literal: "!", Raw: "!"},
+		{Type: Element, Literal: "ELEMENT", Raw: "ELEMENT", Trailing: " "},
+		{Type: Name, Literal: "a", Raw: "a", Trailing: " "},
+		{Type: TagNeed, Literal: "-", Raw: "-", Trailing: " "},
+		{Type: TagUnNeed, Literal: "O", Raw: "O", Trailing: " "},
+		{Type: Empty, Literal: "EMPTY", Raw: "EMPTY"},
+		{Type: RightAngleBracket, Literal: ">", Raw: ">", Trailing: " "},
+		{Type: MarkedSectionEnd, Literal: "]]>", Raw: "]]>"},
+		{Type: EOF, Leading: "\n"},
+	}
+	got, err := NewTriviaLexer(input).Execute()
+	if err != nil {
+		t.Fatalf("failed to lex input: %v", err)
+	}
+	if diff := cmp.Diff(got, want, ignorePosition); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestTriviaLexerRoundTrip(t *testing.T) {
+	// トークンを繋げると元の入力と一致する
+	inputs := map[string]string{
+		"空の入力":    "",
+		"空白だけの入力": " \t\r\n",
+		"処理命令":    "<?xml version='1.0' encoding='UTF-8'?>\n<?sgml ok>",
+		"読み飛ばす条件付きセクション": "<!ENTITY % draft 'IGNORE'>\n<![ %draft; [\n  <![ INCLUDE [ <!ELEMENT a - O EMPTY> ]]>\n]]>\t\n",
+		"文字参照": "<!ENTITY lt \"&#60;\" -- less than -->",
+	}
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.dtd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[path] = string(data)
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			tokens, err := NewTriviaLexer(input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			var got strings.Builder
+			for _, token := range tokens {
+				got.WriteString(token.Text())
+			}
+			if diff := cmp.Diff(got.String(), input); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			if last := tokens[len(tokens)-1]; last.Type != EOF {
+				t.Errorf("last token mismatch want: %s, but got %s", EOF, last.Type)
+			}
+		})
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	// 読み込みの区切りをまたいでも文字列から読んだ場合と同じトークンになる
+	large := strings.Repeat("<!ELEMENT 人物 - O (名前,年齢?) -- コメント -->\n<!ATTLIST 人物 id ID #REQUIRED>\n", 200)
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_ELEMENT",
+			input: "<!ELEMENT person - O (name,age?) +(note)>",
+		},
+		{
+			name:  "成功ケース_コメント",
+			input: "<!-- 人物 -->\n<!ENTITY % a 'b' -- コメント -->",
+		},
+		{
+			name:  "成功ケース_大きな入力",
+			input: large,
+		},
+		{
+			name:  "成功ケース_文字参照",
+			input: large + "<!ENTITY a '&#x3C;&amp;&#12354;'>",
+		},
+		{
+			name:    "大きな入力の末尾でエラーが発生する",
+			input:   large + "<!ELEMINT b - - EMPTY>",
+			wantErr: ErrElementTokenize,
+		},
+		{
+			name:    "閉じられていない文字列でエラーが発生する",
+			input:   large + "<!ENTITY a\n\t'b>",
+			wantErr: ErrStringTokenize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := NewLexer(tt.input).Execute()
+			sut := NewReaderLexer(iotest.OneByteReader(strings.NewReader(tt.input)))
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			// 字句解析を終えた部分は捨てられている
+			if len(sut.input) > 2*snippetContext {
+				t.Errorf("buffer is not discarded: %d bytes", len(sut.input))
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			var syntaxErr, wantSyntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) || !errors.As(wantErr, &wantSyntaxErr) {
+				t.Fatalf("error is not SyntaxError: %v", err)
+			}
+			if diff := cmp.Diff(syntaxErr.Error(), wantSyntaxErr.Error()); diff != "" {
+				t.Errorf("message mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(syntaxErr.Snippet(), wantSyntaxErr.Snippet()); diff != "" {
+				t.Errorf("snippet mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReaderLexerReadError(t *testing.T) {
+	// 読み込みに失敗した場合は途切れた入力の字句解析エラーではなく読み込みのエラーを返す
+	sut := NewReaderLexer(iotest.TimeoutReader(iotest.HalfReader(strings.NewReader("<!ENTITY a 'bcdefgh'>"))))
+	_, err := sut.Execute()
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("error mismatch want: %v, but got %v", iotest.ErrTimeout, err)
+	}
+}
+
+func TestLexerAllocs(t *testing.T) {
+	// トークンの文字列は入力から切り出すので、文字列から読む場合はメモリを割り当てない
+	input := "<!-- 人物 --><!ELEMENT 人物 - O (名前,年齢?) +(注記)><!ATTLIST 人物 id ID #REQUIRED 性別 (男|女) '女'>"
+	allocs := testing.AllocsPerRun(10, func() {
+		sut := NewLexer(input)
+		for _, err := sut.NextToken(); err == nil; _, err = sut.NextToken() {
+		}
+	})
+	// NewLexerでのレキサー自体の割り当てのみ
+	if allocs > 1 {
+		t.Errorf("allocs mismatch want: <= 1, but got %v", allocs)
+	}
+}
+
+// benchmarkInput ベンチマークに使う入力1つ分
+type benchmarkInput struct {
+	name string
+	data string
+}
+
+// benchmarkInputs testdata以下のDTDを、大きなDTDを想定して約1MBになるまで繰り返したもの
+// DocBookやTEIなどのDTDをtestdataに置けば合わせて計測できる
+func benchmarkInputs(b *testing.B) []benchmarkInput {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.dtd"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	inputs := []benchmarkInput{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs = append(inputs, benchmarkInput{
+			name: filepath.Base(path),
+			data: strings.Repeat(string(data)+"\n", 1<<20/(len(data)+1)+1),
+		})
+	}
+	return inputs
+}
+
+// reportAllocsPerToken 1トークンあたりのメモリ割り当て回数を記録する
+func reportAllocsPerToken(b *testing.B, tokens int, run func()) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		run()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*tokens), "allocs/token")
+}
+
+func BenchmarkLexer(b *testing.B) {
+	for _, in := range benchmarkInputs(b) {
+		b.Run(in.name, func(b *testing.B) {
+			tokens, err := NewLexer(in.data).Execute()
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(in.data)))
+			b.ReportAllocs()
+			reportAllocsPerToken(b, len(tokens), func() {
+				sut := NewLexer(in.data)
+				for _, err := sut.NextToken(); err == nil; _, err = sut.NextToken() {
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkReaderLexer(b *testing.B) {
+	for _, in := range benchmarkInputs(b) {
+		b.Run(in.name, func(b *testing.B) {
+			tokens, err := NewLexer(in.data).Execute()
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(in.data)))
+			b.ReportAllocs()
+			reportAllocsPerToken(b, len(tokens), func() {
+				sut := NewReaderLexer(strings.NewReader(in.data))
+				for _, err := sut.NextToken(); err == nil; _, err = sut.NextToken() {
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkReaderLexerLargeToken(b *testing.B) {
+	// 途中で捨てられない長いトークンも、長さに比例した時間で読める
+	body := strings.Repeat("<!ELEMENT p - O (#PCDATA)>\n", 16<<20/27)
+	inputs := []struct {
+		name string
+		data string
+	}{
+		{name: "IGNORE", data: "<![ IGNORE [" + body + "]]>"},
+		{name: "comment", data: "<!--" + body + "-->"},
+		{name: "literal", data: "<!ENTITY a '" + body + "'>"},
+	}
+	for _, in := range inputs {
+		b.Run(in.name, func(b *testing.B) {
+			b.SetBytes(int64(len(in.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sut := NewReaderLexer(strings.NewReader(in.data))
+				for _, err := sut.NextToken(); err != io.EOF; _, err = sut.NextToken() {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTriviaLexerRecovery(t *testing.T) {
+	// 失敗した後に入力の末尾まで読み飛ばしても、EOFトークンで終わる
+	tokens, errs := NewTriviaLexer("<!ELEMENT a - O (b）>").ExecuteAll()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrCharacterTokenize) {
+		t.Errorf("errors mismatch want: %v, but got %v", ErrCharacterTokenize, errs)
+	}
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != EOF {
+		t.Fatalf("last token is not EOF: %v", tokens)
+	}
+	if got := tokens[len(tokens)-1].Leading; got != "" {
+		t.Errorf("EOF leading mismatch want: empty, but got %q", got)
+	}
+}
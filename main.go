@@ -1,37 +1,271 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 )
 
+const (
+	exitOK    = 0
+	exitError = 1 // 字句解析・構文解析・検証の失敗
+	exitUsage = 2 // コマンドライン引数の誤り
+)
+
+const usage = `usage: go-dtd <command> [flags] [file ...]
+
+commands:
+  tokens    print the tokens of the DTD
+  parse     print the declarations of the DTD
+  gen       generate Go structs for encoding/xml from the DTD
+  validate  check the DTD for errors
+
+Reads from standard input when no file (or "-") is given.
+Run "go-dtd <command> -h" for the flags of each command.
+`
+
 func main() {
-	// TODO: DTDファイルを読み取る
-	f, err := os.Open("examples/example01.dtd")
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "write output to `file` instead of standard output")
+	var packageName *string
+	jsonOutput := new(bool)
+	expand := new(bool)
+	switch command {
+	case "tokens":
+		jsonOutput = flags.Bool("json", false, "print the tokens as JSON lines, one object per file")
+	case "parse", "validate":
+		expand = expandFlag(flags)
+	case "gen":
+		packageName = flags.String("package", "dtd", "package `name` of the generated file")
+		expand = expandFlag(flags)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "go-dtd: unknown command %q\n\n%s", command, usage)
+		return exitUsage
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	inputs, err := readInputs(flags.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "go-dtd: %v\n", err)
+		return exitError
+	}
+
+	// 途中で失敗した場合に出力先を中途半端に書き換えないよう、結果は全て揃ってから書き出す
+	out := &bytes.Buffer{}
+	status := exitOK
+	switch command {
+	case "tokens":
+		status = tokensCommand(inputs, *jsonOutput, out, stderr)
+	case "parse":
+		status = parseCommand(inputs, *expand, out, stderr)
+	case "gen":
+		status = genCommand(inputs, *packageName, *expand, out, stderr)
+	case "validate":
+		status = validateCommand(inputs, *expand, out, stderr)
+	}
+	if status != exitOK {
+		// tokensは失敗しても読めたトークンを標準出力に表示する(出力ファイルは書き換えない)
+		if command == "tokens" && *output == "" {
+			stdout.Write(out.Bytes())
+		}
+		return status
+	}
+
+	if *output == "" {
+		stdout.Write(out.Bytes())
+		return exitOK
+	}
+	if err := ioutil.WriteFile(*output, out.Bytes(), 0644); err != nil {
+		fmt.Fprintf(stderr, "go-dtd: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// expandFlag 宣言を読む前にパラメータ実体参照を展開するかどうかのフラグ
+func expandFlag(flags *flag.FlagSet) *bool {
+	return flags.Bool("expand", false, "expand parameter entity references before parsing")
+}
+
+// input 読み込んだ入力ファイル1つ分
+type input struct {
+	name string
+	data string
+}
+
+func readInputs(paths []string, stdin io.Reader) ([]input, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	inputs := []input{}
+	for _, path := range paths {
+		if path == "-" {
+			data, err := ioutil.ReadAll(stdin)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, input{name: "<stdin>", data: string(data)})
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input{name: path, data: string(data)})
+	}
+	return inputs, nil
+}
+
+// tokenFile tokens -json で出力する入力ファイル1つ分のトークン
+type tokenFile struct {
+	File   string  `json:"file"`
+	Tokens []Token `json:"tokens"`
+}
+
+func tokensCommand(inputs []input, jsonOutput bool, out, stderr io.Writer) int {
+	for _, in := range inputs {
+		// 失敗しても読めたトークンは全て表示する
+		tokens, errs := NewLexer(in.data).ExecuteAll()
+		if jsonOutput {
+			// DTDは < や & を多く含むので、読みやすさのためにHTML向けのエスケープはしない
+			encoder := json.NewEncoder(out)
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(tokenFile{File: in.name, Tokens: tokens}); err != nil {
+				fmt.Fprintf(stderr, "go-dtd: %v\n", err)
+				return exitError
+			}
+		} else {
+			for _, token := range tokens {
+				fmt.Fprintf(out, "%s\t%s\t%s\n", token.Start, token.Type, token.Literal)
+			}
+		}
+		if len(errs) > 0 {
+			printErrors(stderr, in.name, errs)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+func parseCommand(inputs []input, expand bool, out, stderr io.Writer) int {
+	for _, in := range inputs {
+		dtd, errs := parseInput(in, expand)
+		if len(errs) > 0 {
+			printErrors(stderr, in.name, errs)
+			return exitError
+		}
+		for _, decl := range dtd.Declarations {
+			fmt.Fprintln(out, decl.String())
+		}
+	}
+	return exitOK
+}
+
+func genCommand(inputs []input, packageName string, expand bool, out, stderr io.Writer) int {
+	// 複数の入力は1つのDTDとしてまとめて生成する
+	merged := &DTD{Declarations: []Declaration{}}
+	for _, in := range inputs {
+		dtd, errs := parseInput(in, expand)
+		if len(errs) > 0 {
+			printErrors(stderr, in.name, errs)
+			return exitError
+		}
+		merged.Declarations = append(merged.Declarations, dtd.Declarations...)
+	}
+	src, err := NewGenerator(merged, packageName).Execute()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintf(stderr, "go-dtd: %v\n", err)
+		return exitError
 	}
-	defer f.Close()
+	out.Write(src)
+	return exitOK
+}
+
+func validateCommand(inputs []input, expand bool, out, stderr io.Writer) int {
+	status := exitOK
+	for _, in := range inputs {
+		dtd, errs := parseInput(in, expand)
+		if len(errs) > 0 {
+			printErrors(stderr, in.name, errs)
+			status = exitError
+			continue
+		}
+		errs = NewValidator(dtd).Execute()
+		for _, err := range errs {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+		}
+		if len(errs) > 0 {
+			status = exitError
+			continue
+		}
+		fmt.Fprintf(out, "%s: ok\n", in.name)
+	}
+	return status
+}
 
-	data, err := ioutil.ReadAll(f)
+// parseInput 字句解析に失敗した場合は全ての失敗箇所をエラーとして返す
+// expandの場合はパラメータ実体参照を展開してから字句解析する。エラーの位置は元の入力での位置になる
+func parseInput(in input, expand bool) (*DTD, []error) {
+	var tokens []Token
+	var errs []error
+	if expand {
+		tokens, errs = NewExpander(in.data).ExecuteAll()
+	} else {
+		tokens, errs = NewLexer(in.data).ExecuteAll()
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	dtd, err := NewParser(tokens).Execute()
 	if err != nil {
-		fmt.Println(err)
-	}
-	fmt.Println(data)
-	// TODO: DTDファイルを字句解析する
-	// lexer := lexer.NewLexer(data)
-	// tokens, err := lexer.Execute()
-	// if err != nil {
-	// 	fmt.Println(err)
-	// }
-
-	// TODO: 字句解析したトークン群を構文解析してDTDの構造体
-	// parser := parser.NewParser(tokens)
-	// dtd, err := parser.Execute()
-	// if err != nil {
-	// 	fmt.Println(err)
-	// }
-
-	// TODO: DTDの構造体からGoのxmlに準拠したUnmarshal用の構造体ファイルを出力する
+		// パーサーは入力を持たないので、失敗した行を表示できるようここで入力を持たせる
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.source == "" {
+			syntaxErr.source = in.data
+		}
+		return nil, []error{err}
+	}
+	return dtd, nil
+}
+
+// printErrors 全てのエラーを順に表示する
+func printErrors(w io.Writer, name string, errs []error) {
+	for _, err := range errs {
+		printError(w, name, err)
+	}
+}
+
+// printError 字句解析のエラーであれば失敗箇所も合わせて表示する
+func printError(w io.Writer, name string, err error) {
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		fmt.Fprintf(w, "%s: %v\n", name, err)
+		return
+	}
+	// コンパイラと同じく file:line:column: message の形式で表示する
+	fmt.Fprintf(w, "%s:%v\n%s\n", name, err, syntaxErr.Snippet())
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "成功ケース_tokens",
+			args:       []string{"tokens"},
+			stdin:      "<!ELEMENT person - O EMPTY>",
+			wantStatus: exitOK,
+			wantStdout: "1:1\tLeftAngleBracket\t<\n1:2\tExclamation\t!\n1:3\tElement\tELEMENT\n1:11\tName\tperson\n1:18\tTagNeed\t-\n1:20\tTagUnNeed\tO\n1:22\tEmpty\tEMPTY\n1:27\tRightAngleBracket\t>\n",
+		},
+		{
+			name:       "成功ケース_tokensをJSONで出力する",
+			args:       []string{"tokens", "--json"},
+			stdin:      "<!ENTITY a '&b;'>",
+			wantStatus: exitOK,
+			wantStdout: `{"file":"<stdin>","tokens":[` +
+				`{"type":"LeftAngleBracket","literal":"<","start":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2}},` +
+				`{"type":"Exclamation","literal":"!","start":{"offset":1,"line":1,"column":2},"end":{"offset":2,"line":1,"column":3}},` +
+				`{"type":"Entity","literal":"ENTITY","start":{"offset":2,"line":1,"column":3},"end":{"offset":8,"line":1,"column":9}},` +
+				`{"type":"Name","literal":"a","start":{"offset":9,"line":1,"column":10},"end":{"offset":10,"line":1,"column":11}},` +
+				`{"type":"String","literal":"&b;","start":{"offset":11,"line":1,"column":12},"end":{"offset":16,"line":1,"column":17},"references":["b"]},` +
+				`{"type":"RightAngleBracket","literal":">","start":{"offset":16,"line":1,"column":17},"end":{"offset":17,"line":1,"column":18}}` +
+				"]}\n",
+		},
+		{
+			name:       "成功ケース_parse",
+			args:       []string{"parse", "-"},
+			stdin:      "<!ELEMENT person - O (name,age?)><!ATTLIST person id NAME #REQUIRED>",
+			wantStatus: exitOK,
+			wantStdout: "<!ELEMENT person - O (name,age?)>\n<!ATTLIST person\n  id NAME #REQUIRED>\n",
+		},
+		{
+			name:       "成功ケース_parseで実体宣言を出力する",
+			args:       []string{"parse"},
+			stdin:      "<!ENTITY % HTMLlat1 PUBLIC \"-//W3C//ENTITIES Latin 1//EN//HTML\" \"HTMLlat1.ent\"><!ENTITY logo SYSTEM 'logo.gif' NDATA gif><!ENTITY nbsp CDATA \"&#160;\">",
+			wantStatus: exitOK,
+			wantStdout: "<!ENTITY % HTMLlat1 PUBLIC \"-//W3C//ENTITIES Latin 1//EN//HTML\" \"HTMLlat1.ent\">\n<!ENTITY logo SYSTEM \"logo.gif\" NDATA gif>\n<!ENTITY nbsp CDATA \"&#160;\">\n",
+		},
+		{
+			name:       "成功ケース_parseでパラメータ実体参照を展開する",
+			args:       []string{"parse", "-expand"},
+			stdin:      "<!ENTITY % inline \"#PCDATA|em\"><!ELEMENT p - O (%inline;)*>",
+			wantStatus: exitOK,
+			wantStdout: "<!ENTITY % inline \"#PCDATA|em\">\n<!ELEMENT p - O (#PCDATA|em)*>\n",
+		},
+		{
+			name:       "再帰的なパラメータ実体参照",
+			args:       []string{"validate", "-expand"},
+			stdin:      "<!ENTITY % a \"(%b;)\">\n<!ENTITY % b \"x|%a;\">\n<!ELEMENT p - O %a;>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>:3:17: %a; -> %b; -> %a;: recursive parameter entity reference: found \"%a;\"\n<!ELEMENT p - O %a;>\n                ^~~\n",
+		},
+		{
+			name:       "展開した値の中の失敗も含めて全ての失敗箇所を元の入力の位置で表示する",
+			args:       []string{"parse", "-expand"},
+			stdin:      "<!ENTITY % d '<!ELEMINT p - O EMPTY>'>\n%d;\n<!ELEMINT q - O EMPTY>\n<!ATTLEST r a CDATA #IMPLIED>\n",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>:2:1: failed to element tokenize: ELEMINT: did you mean ELEMENT? (in expansion of %d;)\n%d;\n^~~\n" +
+				"<stdin>:3:3: failed to element tokenize: ELEMINT: did you mean ELEMENT?\n<!ELEMINT q - O EMPTY>\n  ^~~~~~~\n" +
+				"<stdin>:4:3: failed to attlist tokenize: ATTLEST: did you mean ATTLIST?\n<!ATTLEST r a CDATA #IMPLIED>\n  ^~~~~~~\n",
+		},
+		{
+			name:       "成功ケース_validate",
+			args:       []string{"validate"},
+			stdin:      "<!ELEMENT person - O EMPTY>",
+			wantStatus: exitOK,
+			wantStdout: "<stdin>: ok\n",
+		},
+		{
+			name:       "宣言されていない子要素があり検証に失敗する",
+			args:       []string{"validate"},
+			stdin:      "<!ELEMENT person - O (name)>",
+			wantStatus: exitError,
+			wantStdout: "",
+		},
+		{
+			name:       "綴りの近い要素名を案内する",
+			args:       []string{"validate"},
+			stdin:      "<!ELEMENT person - O (nmae)><!ELEMENT name - O EMPTY><!ATTLIST persn id ID #IMPLIED>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>: element \"nmae\" referenced from \"person\": undeclared element: did you mean \"name\"?\n" +
+				"<stdin>: attribute list for element \"persn\": undeclared element: did you mean \"person\"?\n",
+		},
+		{
+			name:       "1文字の名前や宣言中の名前自身は案内しない",
+			args:       []string{"validate"},
+			stdin:      "<!ELEMENT c - O (d)><!ELEMENT item - O (items)><!ENTITY % ab \"%a;\">",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>: element \"d\" referenced from \"c\": undeclared element\n" +
+				"<stdin>: element \"items\" referenced from \"item\": undeclared element\n" +
+				"<stdin>: %a;: undeclared parameter entity\n",
+		},
+		{
+			name:       "宣言されていないパラメータ実体の参照",
+			args:       []string{"validate"},
+			stdin:      "<!ENTITY % inline \"#PCDATA\"><!ELEMENT p - O (%inlin;)*><!ELEMENT q - O (%block;)*>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>: %inlin;: undeclared parameter entity: did you mean %inline;?\n" +
+				"<stdin>: %block;: undeclared parameter entity\n",
+		},
+		{
+			name:       "実体の値の中の宣言されていないパラメータ実体の参照",
+			args:       []string{"validate"},
+			stdin:      "<!ENTITY % attrs \"%coreattrs; %i18n;\">\n<!ENTITY % i18n \"lang NAME #IMPLIED\">",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>: %coreattrs;: undeclared parameter entity\n",
+		},
+		{
+			name:       "宣言されていない記法",
+			args:       []string{"validate"},
+			stdin:      "<!NOTATION gif SYSTEM \"image/gif\">\n<!ENTITY logo SYSTEM \"logo.gif\" NDATA gif>\n<!ENTITY pic SYSTEM \"p.gif\" NDATA gfi>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>: notation \"gfi\" of entity \"pic\": undeclared notation: did you mean \"gif\"?\n",
+		},
+		{
+			name:       "綴りの近い属性の型を案内する",
+			args:       []string{"parse"},
+			stdin:      "<!ATTLIST a b CDAT #IMPLIED>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>:1:15: unknown type \"CDAT\" of attribute \"b\": failed to attlist parse: did you mean CDATA?\n<!ATTLIST a b CDAT #IMPLIED>\n              ^\n",
+		},
+		{
+			name:       "字句解析に失敗する",
+			args:       []string{"parse"},
+			stdin:      "<!ELEMINT person - O (name)>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>:1:3: failed to element tokenize: ELEMINT: did you mean ELEMENT?\n<!ELEMINT person - O (name)>\n  ^~~~~~~\n",
+		},
+		{
+			name:       "字句解析の失敗箇所を全て表示する",
+			args:       []string{"validate"},
+			stdin:      "<!ELEMINT person - O (name)>\n<!ELEMENT name - O (#PCDATA）>",
+			wantStatus: exitError,
+			wantStdout: "",
+			wantStderr: "<stdin>:1:3: failed to element tokenize: ELEMINT: did you mean ELEMENT?\n<!ELEMINT person - O (name)>\n  ^~~~~~~\n" +
+				"<stdin>:2:28: failed to character tokenize: found \"）\", expected \")\" instead of full-width U+FF09\n<!ELEMENT name - O (#PCDATA）>\n                           ^~\n",
+		},
+		{
+			name:       "tokensは失敗しても読めたトークンを全て表示する",
+			args:       []string{"tokens"},
+			stdin:      "<!ELEMINT a - O EMPTY>\n<!ELEMENT b EMPTY>",
+			wantStatus: exitError,
+			wantStdout: "1:1\tLeftAngleBracket\t<\n1:2\tExclamation\t!\n2:1\tLeftAngleBracket\t<\n2:2\tExclamation\t!\n2:3\tElement\tELEMENT\n2:11\tName\tb\n2:13\tEmpty\tEMPTY\n2:18\tRightAngleBracket\t>\n",
+			wantStderr: "<stdin>:1:3: failed to element tokenize: ELEMINT: did you mean ELEMENT?\n<!ELEMINT a - O EMPTY>\n  ^~~~~~~\n",
+		},
+		{
+			name:       "存在しないコマンド",
+			args:       []string{"unknown"},
+			wantStatus: exitUsage,
+			wantStdout: "",
+		},
+		{
+			name:       "コマンドの指定がない",
+			args:       []string{},
+			wantStatus: exitUsage,
+			wantStdout: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			got := run(tt.args, strings.NewReader(tt.stdin), stdout, stderr)
+			if got != tt.wantStatus {
+				t.Errorf("status mismatch want: %d, but got %d (stderr: %s)", tt.wantStatus, got, stderr.String())
+			}
+			if diff := cmp.Diff(stdout.String(), tt.wantStdout); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+			if tt.wantStderr != "" {
+				if diff := cmp.Diff(stderr.String(), tt.wantStderr); diff != "" {
+					t.Errorf("stderr mismatch (-got +want):\n%s", diff)
+				}
+			}
+		})
+	}
+}
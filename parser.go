@@ -0,0 +1,678 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrDeclarationParse = errors.New("failed to declaration parse")
+var ErrElementParse = errors.New("failed to element parse")
+var ErrAttListParse = errors.New("failed to attlist parse")
+var ErrEntityParse = errors.New("failed to entity parse")
+var ErrNotationParse = errors.New("failed to notation parse")
+var ErrMarkedSectionParse = errors.New("failed to marked section parse")
+
+// tokenReader 字句解析しながらトークンを1つずつ渡す
+type tokenReader interface {
+	NextToken() (Token, error)
+}
+
+type parser struct {
+	tokens   []Token     // 読み込み済みのトークン
+	position int         // 次に読み込むトークンのインデックス
+	comments []string    // 宣言の中で読み飛ばしたコメント
+	reader   tokenReader // 続きのトークンの読み込み元(全て読み込み済みの場合はnil)
+	err      error       // トークンの読み込みで発生したエラー
+}
+
+func NewParser(tokens []Token) *parser {
+	return &parser{tokens: tokens}
+}
+
+// NewStreamParser 字句解析を進めながら構文解析するパーサーを返す
+// 読み終えた宣言のトークンは捨てるので、大きなDTDでもメモリ使用量は宣言1つ分で済む
+func NewStreamParser(reader tokenReader) *parser {
+	return &parser{tokens: []Token{}, reader: reader}
+}
+
+func (p *parser) Execute() (*DTD, error) {
+	dtd := &DTD{Declarations: []Declaration{}}
+	for {
+		decl, err := p.NextDeclaration()
+		if err == io.EOF {
+			return dtd, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		dtd.Declarations = append(dtd.Declarations, decl)
+	}
+}
+
+// NextDeclaration 次の宣言を1つ読む。全て読み終えた場合はio.EOFを返す
+func (p *parser) NextDeclaration() (Declaration, error) {
+	if p.reader != nil {
+		// 読み終えた宣言のトークンを捨てる
+		if p.position > len(p.tokens) {
+			p.position = len(p.tokens)
+		}
+		p.tokens = append(p.tokens[:0], p.tokens[p.position:]...)
+		p.position = 0
+	}
+	if !p.fill(p.position) {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, io.EOF
+	}
+	decl, err := p.declarationParse()
+	// 字句解析に失敗して途中で途切れた場合は字句解析のエラーを優先する
+	if p.err != nil {
+		return nil, p.err
+	}
+	return decl, err
+}
+
+func (p *parser) declarationParse() (Declaration, error) {
+	switch token := p.tokens[p.position]; token.Type {
+	case Comment:
+		p.position += 1
+		return &CommentDecl{Text: token.Literal}, nil
+	case MarkedSectionStart:
+		return p.markedSectionParse()
+	case PEReference:
+		p.position += 1
+		return &PEReferenceDecl{Name: token.Literal}, nil
+	case ProcessingInstruction:
+		p.position += 1
+		target, data := splitProcessingInstruction(token.Literal)
+		if strings.EqualFold(target, "xml") {
+			// テキスト宣言の誤りは字句解析の時点で検出している
+			version, encoding, _ := parseTextDecl(data)
+			return &TextDecl{Version: version, Encoding: encoding}, nil
+		}
+		return &ProcessingInstructionDecl{Target: target, Data: data}, nil
+	}
+	if _, err := p.expectToken(LeftAngleBracket, ErrDeclarationParse); err != nil {
+		return nil, err
+	}
+	if _, err := p.expectToken(Exclamation, ErrDeclarationParse); err != nil {
+		return nil, err
+	}
+	switch token := p.readToken(); token.Type {
+	case Element:
+		return p.elementParse()
+	case AttList:
+		return p.attListParse()
+	case Entity:
+		return p.entityParse()
+	case Notation:
+		return p.notationParse()
+	default:
+		return nil, p.errorAt(token, errors.Wrapf(ErrDeclarationParse, "unexpected token %q", token.Literal))
+	}
+}
+
+func (p *parser) elementParse() (*ElementDecl, error) {
+	name, names, err := p.nameGroupParse(ErrElementParse)
+	if err != nil {
+		return nil, err
+	}
+	decl := &ElementDecl{Name: name, Names: names}
+
+	// タグ省略指定は開始タグと終了タグの2つが揃っている場合のみ
+	if p.isTagMinimization(p.peakToken()) && p.isTagMinimization(p.peakTokenAt(1)) {
+		decl.Minimization = true
+		decl.OmitStartTag = p.readToken().Type == TagUnNeed
+		decl.OmitEndTag = p.readToken().Type == TagUnNeed
+	}
+
+	// SGMLでは内容モデルを省略して例外だけを書ける
+	if token := p.peakToken(); token.Type != RightAngleBracket && !p.isException() {
+		content, err := p.contentParse()
+		if err != nil {
+			return nil, err
+		}
+		decl.Content = content
+	}
+
+	for p.isException() {
+		token := p.readToken()
+		group, err := p.groupParse(ErrElementParse)
+		if err != nil {
+			return nil, err
+		}
+		names, err := p.groupNames(group, []TokenType{Name}, ErrElementParse)
+		if err != nil {
+			return nil, err
+		}
+		if token.Type == Inclusion {
+			decl.Inclusions = append(decl.Inclusions, names...)
+		} else {
+			decl.Exclusions = append(decl.Exclusions, names...)
+		}
+	}
+
+	decl.Comments = p.takeComments()
+	if _, err := p.expectToken(RightAngleBracket, ErrElementParse); err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+func (p *parser) attListParse() (*AttListDecl, error) {
+	name, names, err := p.nameGroupParse(ErrAttListParse)
+	if err != nil {
+		return nil, err
+	}
+	decl := &AttListDecl{Name: name, Names: names, Attributes: []AttDef{}}
+	for p.peakToken().Type != RightAngleBracket {
+		// 属性定義の前に書かれたコメントは宣言全体へのコメントとして扱う
+		decl.Comments = append(decl.Comments, p.takeComments()...)
+		def, err := p.attDefParse()
+		if err != nil {
+			return nil, err
+		}
+		decl.Attributes = append(decl.Attributes, *def)
+	}
+	decl.Comments = append(decl.Comments, p.takeComments()...)
+	p.readToken()
+	return decl, nil
+}
+
+func (p *parser) attDefParse() (*AttDef, error) {
+	// %attrs; のように属性定義をまとめたパラメータ実体の参照
+	if token := p.peakToken(); token.Type == PEReference {
+		p.readToken()
+		return &AttDef{Reference: token.Literal, Comments: p.takeComments()}, nil
+	}
+	name, err := p.expectToken(Name, ErrAttListParse)
+	if err != nil {
+		return nil, err
+	}
+	def := &AttDef{Name: name.Literal}
+
+	// 属性の型: CDATAなどの予約語、(a|b)のような列挙、またはNOTATION (a|b)
+	switch token := p.peakToken(); {
+	case hasType(attributeTypes, token.Type):
+		def.Type = p.readToken().Literal
+	case token.Type == PEReference:
+		def.Type = referenceString(p.readToken().Literal)
+	case token.Type == Name:
+		return nil, p.errorAt(token, withSuggestion(errors.Wrapf(ErrAttListParse, "unknown type %q of attribute %q", token.Literal, def.Name), suggestKeyword(token.Literal, attributeTypes)))
+	}
+	if p.peakToken().Type == LeftBracket {
+		group, err := p.groupParse(ErrAttListParse)
+		if err != nil {
+			return nil, err
+		}
+		// 列挙型の値は数字などから始まる名前トークンでもよい
+		def.Enumeration, err = p.groupNames(group, []TokenType{Name, NameToken}, ErrAttListParse)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if def.Type == "" && def.Enumeration == nil {
+		return nil, p.errorAt(p.peakToken(), errors.Wrapf(ErrAttListParse, "missing type of attribute %q", def.Name))
+	}
+
+	switch token := p.readToken(); token.Type {
+	case DefaultValueImplied:
+		def.Default = DefaultTypeImplied
+	case DefaultValueRequired:
+		def.Default = DefaultTypeRequired
+	case DefaultValueCurrent:
+		def.Default = DefaultTypeCurrent
+	case DefaultValueConRef:
+		def.Default = DefaultTypeConRef
+	case DefaultValueFixed:
+		// 固定値も通常の既定値と同じく引用符で囲まずに書ける
+		value := p.readToken()
+		if value.Type != String && value.Type != Name && value.Type != NameToken {
+			return nil, p.errorAt(value, errors.Wrapf(ErrAttListParse, "unexpected token %q in fixed value of attribute %q", value.Literal, def.Name))
+		}
+		def.Default = DefaultTypeFixed
+		def.Value = value.Literal
+		def.Source = value.Source
+	case String, Name, NameToken:
+		// SGMLでは既定値を引用符で囲まずに書ける
+		def.Default = DefaultTypeValue
+		def.Value = token.Literal
+		def.Source = token.Source
+	default:
+		return nil, p.errorAt(token, errors.Wrapf(ErrAttListParse, "unexpected token %q in default of attribute %q", token.Literal, def.Name))
+	}
+	// 属性定義の直後のコメントはその属性の説明として扱う
+	def.Comments = p.takeComments()
+	return def, nil
+}
+
+func (p *parser) entityParse() (*EntityDecl, error) {
+	decl := &EntityDecl{}
+	if p.peakToken().Type == Percent {
+		p.readToken()
+		decl.Parameter = true
+	}
+	// SGMLの #DEFAULT は宣言されていない実体の代わりに使われる実体
+	if p.peakToken().Type == DefaultEntity {
+		decl.Name = p.readToken().Literal
+	} else {
+		name, err := p.expectToken(Name, ErrEntityParse)
+		if err != nil {
+			return nil, err
+		}
+		decl.Name = name.Literal
+	}
+
+	switch token := p.peakToken(); {
+	case token.Type == System || token.Type == Public:
+		external, err := p.externalIDParse(ErrEntityParse)
+		if err != nil {
+			return nil, err
+		}
+		decl.External = external
+		if err := p.entityDataParse(decl); err != nil {
+			return nil, err
+		}
+	default:
+		// SGMLでは CDATA "..." のように値の前に実体の種類を書ける
+		if hasType(internalEntityTypes, token.Type) {
+			decl.DataType = EntityDataType(p.readToken().Literal)
+		}
+		value, err := p.expectToken(String, ErrEntityParse)
+		if err != nil {
+			return nil, err
+		}
+		decl.Value = value.Literal
+		decl.Source = value.Source
+		decl.References = value.References
+		decl.PEReferences = value.PEReferences
+	}
+	decl.Comments = p.takeComments()
+	if _, err := p.expectToken(RightAngleBracket, ErrEntityParse); err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+// internalEntityTypes 内部実体の値の前に書ける実体の種類(SGML)
+var internalEntityTypes = []TokenType{
+	CData, EntityTypeSData, EntityTypePI, EntityTypeStartTag, EntityTypeEndTag, EntityTypeMS, EntityTypeMD,
+}
+
+// externalIDParse SYSTEM "system" や PUBLIC "public" "system" の外部識別子を読む
+// SGMLではシステム識別子を省略できる
+func (p *parser) externalIDParse(sentinel error) (*ExternalID, error) {
+	external := &ExternalID{}
+	if p.readToken().Type == Public {
+		public, err := p.expectToken(String, sentinel)
+		if err != nil {
+			return nil, err
+		}
+		external.PublicID = public.Literal
+	}
+	if p.peakToken().Type == String {
+		external.SystemID = p.readToken().Literal
+	}
+	return external, nil
+}
+
+func (p *parser) notationParse() (*NotationDecl, error) {
+	name, err := p.expectToken(Name, ErrNotationParse)
+	if err != nil {
+		return nil, err
+	}
+	decl := &NotationDecl{Name: name.Literal}
+	if token := p.peakToken(); token.Type != System && token.Type != Public {
+		return nil, p.errorAt(token, errors.Wrapf(ErrNotationParse, "expected %s or %s but got %q", System.describe(), Public.describe(), token.Literal))
+	}
+	external, err := p.externalIDParse(ErrNotationParse)
+	if err != nil {
+		return nil, err
+	}
+	decl.External = external
+	decl.Comments = p.takeComments()
+	if _, err := p.expectToken(RightAngleBracket, ErrNotationParse); err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+// entityDataParse 外部実体の後の NDATA name のようなデータの記法や SUBDOC を読む
+func (p *parser) entityDataParse(decl *EntityDecl) error {
+	token := p.peakToken()
+	switch token.Type {
+	case NData, CData, EntityTypeSData:
+		p.readToken()
+		notation, err := p.expectToken(Name, ErrEntityParse)
+		if err != nil {
+			return err
+		}
+		decl.DataType = EntityDataType(token.Literal)
+		decl.Notation = notation.Literal
+	case EntityTypeSubDoc:
+		p.readToken()
+		decl.DataType = EntityDataSubDoc
+	default:
+		return nil
+	}
+	// パラメータ実体は宣言の中で展開するので、解析対象外のデータにはできない
+	if decl.Parameter {
+		return p.errorAt(token, errors.Wrapf(ErrEntityParse, "parameter entity %q cannot be %s", decl.Name, decl.DataType))
+	}
+	return nil
+}
+
+func (p *parser) markedSectionParse() (*MarkedSection, error) {
+	if _, err := p.expectToken(MarkedSectionStart, ErrMarkedSectionParse); err != nil {
+		return nil, err
+	}
+	section := &MarkedSection{Keywords: []string{}}
+	for p.peakToken().Type != LeftSquareBracket {
+		switch token := p.readToken(); {
+		case hasType(sectionKeywords, token.Type):
+			section.Keywords = append(section.Keywords, token.Literal)
+		case token.Type == PEReference:
+			section.Keywords = append(section.Keywords, referenceString(token.Literal))
+		case token.Type == Illegal:
+			return nil, p.errorAt(token, errors.Wrapf(ErrMarkedSectionParse, "expected %q but reached end of input", LeftSquareBracket.Literal()))
+		default:
+			return nil, p.errorAt(token, errors.Wrapf(ErrMarkedSectionParse, "unexpected token %q in status keywords", token.Literal))
+		}
+	}
+	p.readToken()
+
+	// 読み飛ばす内容は字句解析の時点で1つのトークンにまとめられている
+	if token := p.peakToken(); token.Type == IgnoredSection {
+		p.readToken()
+		section.Ignored = true
+		section.Text = token.Literal
+	} else {
+		section.Declarations = []Declaration{}
+		for {
+			if !p.fill(p.position) {
+				return nil, p.errorAt(Token{}, errors.Wrapf(ErrMarkedSectionParse, "expected %q but reached end of input", MarkedSectionEnd.Literal()))
+			}
+			if p.tokens[p.position].Type == MarkedSectionEnd {
+				break
+			}
+			decl, err := p.declarationParse()
+			if err != nil {
+				return nil, err
+			}
+			section.Declarations = append(section.Declarations, decl)
+		}
+	}
+	if _, err := p.expectToken(MarkedSectionEnd, ErrMarkedSectionParse); err != nil {
+		return nil, err
+	}
+	return section, nil
+}
+
+func (p *parser) contentParse() (ContentModel, error) {
+	switch token := p.peakToken(); token.Type {
+	case Empty:
+		p.readToken()
+		return EmptyContent{}, nil
+	case Any:
+		p.readToken()
+		return AnyContent{}, nil
+	case CData, RCData:
+		p.readToken()
+		return DeclaredContent{Keyword: token.Literal}, nil
+	case PEReference:
+		p.readToken()
+		return &PEReferenceContent{Name: token.Literal, Occurrence: p.occurrenceParse()}, nil
+	case LeftBracket:
+		return p.modelGroupParse()
+	case Name:
+		return nil, p.errorAt(token, withSuggestion(errors.Wrapf(ErrElementParse, "unexpected token %q in content model", token.Literal), suggestKeyword(token.Literal, contentKeywords)))
+	default:
+		return nil, p.errorAt(token, errors.Wrapf(ErrElementParse, "unexpected token %q in content model", token.Literal))
+	}
+}
+
+func (p *parser) modelGroupParse() (*Group, error) {
+	if _, err := p.expectToken(LeftBracket, ErrElementParse); err != nil {
+		return nil, err
+	}
+	group := &Group{Children: []ContentModel{}}
+	for {
+		var child ContentModel
+		switch token := p.peakToken(); token.Type {
+		case PCData:
+			p.readToken()
+			child = PCDataContent{}
+		case Name:
+			p.readToken()
+			child = &ElementContent{Name: token.Literal, Occurrence: p.occurrenceParse()}
+		case PEReference:
+			p.readToken()
+			child = &PEReferenceContent{Name: token.Literal, Occurrence: p.occurrenceParse()}
+		case LeftBracket:
+			g, err := p.modelGroupParse()
+			if err != nil {
+				return nil, err
+			}
+			child = g
+		default:
+			return nil, p.errorAt(token, errors.Wrapf(ErrElementParse, "unexpected token %q in model group", token.Literal))
+		}
+		group.Children = append(group.Children, child)
+
+		token := p.readToken()
+		if token.Type == RightBracket {
+			break
+		}
+		var connector Connector
+		switch token.Type {
+		case Comma:
+			connector = ConnectorSequence
+		case VerticalLine:
+			connector = ConnectorChoice
+		case Ampersand:
+			connector = ConnectorAnd
+		default:
+			return nil, p.errorAt(token, errors.Wrapf(ErrElementParse, "unexpected token %q in model group", token.Literal))
+		}
+		// 1つのモデル群の中で区切り文字を混在させることはできない
+		if group.Connector != "" && group.Connector != connector {
+			return nil, p.errorAt(token, errors.Wrapf(ErrElementParse, "mixed connectors %q and %q in model group", group.Connector, connector))
+		}
+		group.Connector = connector
+	}
+	if group.Connector == "" {
+		group.Connector = ConnectorSequence
+	}
+	group.Occurrence = p.occurrenceParse()
+	return group, nil
+}
+
+func (p *parser) occurrenceParse() Occurrence {
+	switch p.peakToken().Type {
+	case Asterisk:
+		p.readToken()
+		return OccurrenceZeroOrMore
+	case Question:
+		p.readToken()
+		return OccurrenceOptional
+	case Plus:
+		p.readToken()
+		return OccurrenceOneOrMore
+	default:
+		return OccurrenceOnce
+	}
+}
+
+// isException +(name)や-(name)のような例外の開始位置かどうか
+func (p *parser) isException() bool {
+	token := p.peakToken()
+	return token.Type == Inclusion || token.Type == Exclusion
+}
+
+// groupParse 対応する閉じ括弧までのトークンを括弧を含めて返す
+func (p *parser) groupParse(sentinel error) ([]Token, error) {
+	open, err := p.expectToken(LeftBracket, sentinel)
+	if err != nil {
+		return nil, err
+	}
+	group := []Token{open}
+	depth := 1
+	for depth > 0 {
+		token := p.readToken()
+		switch token.Type {
+		case Illegal:
+			return nil, p.errorAt(token, errors.Wrap(sentinel, "unclosed group"))
+		case LeftBracket:
+			depth++
+		case RightBracket:
+			depth--
+		case RightAngleBracket:
+			return nil, p.errorAt(token, errors.Wrap(sentinel, "unclosed group"))
+		}
+		group = append(group, token)
+	}
+	return group, nil
+}
+
+// nameParse 宣言の対象の名前を読む。パラメータ実体参照は %name; のまま返す
+func (p *parser) nameParse(sentinel error) (string, error) {
+	if token := p.peakToken(); token.Type == PEReference {
+		p.readToken()
+		return referenceString(token.Literal), nil
+	}
+	name, err := p.expectToken(Name, sentinel)
+	if err != nil {
+		return "", err
+	}
+	return name.Literal, nil
+}
+
+// nameGroupParse 宣言の対象の名前か、(a|b) のような名前グループを読む
+// 名前グループの場合はグループ中の名前を返し、名前は空になる
+func (p *parser) nameGroupParse(sentinel error) (string, []string, error) {
+	if p.peakToken().Type != LeftBracket {
+		name, err := p.nameParse(sentinel)
+		return name, nil, err
+	}
+	group, err := p.groupParse(sentinel)
+	if err != nil {
+		return "", nil, err
+	}
+	names, err := p.groupNames(group, []TokenType{Name}, sentinel)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", names, nil
+}
+
+// groupNames groupParseで読んだ括弧の中の名前を返す。パラメータ実体参照は %name; のまま返す
+// nameTypesに含まれない種類の名前があればエラーを返す
+func (p *parser) groupNames(group []Token, nameTypes []TokenType, sentinel error) ([]string, error) {
+	names := []string{}
+	for _, t := range group {
+		switch {
+		case t.Type == PEReference:
+			names = append(names, referenceString(t.Literal))
+		case hasType(nameTypes, t.Type):
+			names = append(names, t.Literal)
+		case t.Type == Name || t.Type == NameToken:
+			return nil, p.errorAt(t, errors.Wrapf(sentinel, "unexpected %s %q in group", t.Type, t.Literal))
+		}
+	}
+	return names, nil
+}
+
+// hasType typesにtが含まれるかどうか
+func hasType(types []TokenType, t TokenType) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) isTagMinimization(token Token) bool {
+	return token.Type == TagNeed || token.Type == TagUnNeed
+}
+
+func (p *parser) expectToken(tokenType TokenType, sentinel error) (Token, error) {
+	token := p.readToken()
+	if token.Type != tokenType {
+		if token.Type == Illegal {
+			return Token{}, p.errorAt(token, errors.Wrapf(sentinel, "expected %s but reached end of input", tokenType.describe()))
+		}
+		return Token{}, p.errorAt(token, errors.Wrapf(sentinel, "expected %s but got %q", tokenType.describe(), token.Literal))
+	}
+	return token, nil
+}
+
+// errorAt errにtokenの位置を持たせる。入力の終わりで失敗した場合は最後のトークンの直後の位置にする
+func (p *parser) errorAt(token Token, err error) error {
+	pos := token.Start
+	if token.Type == Illegal && len(p.tokens) > 0 {
+		pos = p.tokens[len(p.tokens)-1].End
+	}
+	return &SyntaxError{Err: err, Pos: pos}
+}
+
+// readToken 宣言の中のコメントを読み飛ばして次のトークンを読む
+func (p *parser) readToken() Token {
+	p.skipComments()
+	token := p.peakToken()
+	p.position += 1
+	return token
+}
+
+func (p *parser) peakToken() Token {
+	return p.peakTokenAt(0)
+}
+
+// peakTokenAt コメントを除いてoffset個先のトークンを返す
+func (p *parser) peakTokenAt(offset int) Token {
+	for i := p.position; p.fill(i); i++ {
+		if p.tokens[i].Type == Comment {
+			continue
+		}
+		if offset == 0 {
+			return p.tokens[i]
+		}
+		offset--
+	}
+	// 入力が終わったら空のトークンを返す
+	return Token{}
+}
+
+func (p *parser) skipComments() {
+	for p.fill(p.position) && p.tokens[p.position].Type == Comment {
+		p.comments = append(p.comments, p.tokens[p.position].Literal)
+		p.position += 1
+	}
+}
+
+// takeComments これまでに読み飛ばしたコメントを取り出す
+func (p *parser) takeComments() []string {
+	p.skipComments()
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
+// fill i番目のトークンまで読み込み、読み込めた場合はtrueを返す
+func (p *parser) fill(i int) bool {
+	for p.reader != nil && len(p.tokens) <= i {
+		token, err := p.reader.NextToken()
+		if err != nil {
+			if err != io.EOF {
+				p.err = err
+			}
+			p.reader = nil
+			break
+		}
+		p.tokens = append(p.tokens, token)
+	}
+	return i < len(p.tokens)
+}
@@ -0,0 +1,1174 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestElementParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_子要素の数が1つ",
+			input: "<!ELEMENT person - O (name)>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						OmitEndTag:   true,
+						Content: &Group{
+							Connector: ConnectorSequence,
+							Children: []ContentModel{
+								&ElementContent{Name: "name"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_子要素がEMPTY",
+			input: "<!ELEMENT person - O EMPTY>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						OmitEndTag:   true,
+						Content:      EmptyContent{},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_子要素の数が1つでアスタリスクで修飾",
+			input: "<!ELEMENT person - O (name)*>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						OmitEndTag:   true,
+						Content: &Group{
+							Connector: ConnectorSequence,
+							Children: []ContentModel{
+								&ElementContent{Name: "name"},
+							},
+							Occurrence: OccurrenceZeroOrMore,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_包含例外と除外例外",
+			input: "<!ELEMENT person - O (name) +(age) -(license)>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						OmitEndTag:   true,
+						Content: &Group{
+							Connector: ConnectorSequence,
+							Children: []ContentModel{
+								&ElementContent{Name: "name"},
+							},
+						},
+						Inclusions: []string{"age"},
+						Exclusions: []string{"license"},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_子要素に出現回数の指定",
+			input: "<!ELEMENT person - - (name,age?,license*,hobby+)>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						Content: &Group{
+							Connector: ConnectorSequence,
+							Children: []ContentModel{
+								&ElementContent{Name: "name"},
+								&ElementContent{Name: "age", Occurrence: OccurrenceOptional},
+								&ElementContent{Name: "license", Occurrence: OccurrenceZeroOrMore},
+								&ElementContent{Name: "hobby", Occurrence: OccurrenceOneOrMore},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_入れ子のモデル群",
+			input: "<!ELEMENT person - - ((name|nickname)&age)+>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						Content: &Group{
+							Connector: ConnectorAnd,
+							Children: []ContentModel{
+								&Group{
+									Connector: ConnectorChoice,
+									Children: []ContentModel{
+										&ElementContent{Name: "name"},
+										&ElementContent{Name: "nickname"},
+									},
+								},
+								&ElementContent{Name: "age"},
+							},
+							Occurrence: OccurrenceOneOrMore,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_混合内容",
+			input: "<!ELEMENT p - - (#PCDATA|em)*>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "p",
+						Minimization: true,
+						Content: &Group{
+							Connector: ConnectorChoice,
+							Children: []ContentModel{
+								PCDataContent{},
+								&ElementContent{Name: "em"},
+							},
+							Occurrence: OccurrenceZeroOrMore,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_子要素がANY",
+			input: "<!ELEMENT person ANY>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:    "person",
+						Content: AnyContent{},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_子要素がCDATA",
+			input: "<!ELEMENT script - - CDATA >",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "script",
+						Minimization: true,
+						Content:      DeclaredContent{Keyword: "CDATA"},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_子要素がRCDATA",
+			input: "<!ELEMENT textarea - - RCDATA>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "textarea",
+						Minimization: true,
+						Content:      DeclaredContent{Keyword: "RCDATA"},
+					},
+				},
+			},
+		},
+		{
+			name:    "宣言内容が予約語ではなくエラーが発生する",
+			input:   "<!ELEMENT textarea - - TEXT>",
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+		{
+			name:  "成功ケース_出現回数と包含例外",
+			input: "<!ELEMENT person - - (name)+ +(age)>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						Content: &Group{
+							Connector: ConnectorSequence,
+							Children: []ContentModel{
+								&ElementContent{Name: "name"},
+							},
+							Occurrence: OccurrenceOneOrMore,
+						},
+						Inclusions: []string{"age"},
+					},
+				},
+			},
+		},
+		{
+			name:    "区切り文字が混在していてエラーが発生する",
+			input:   "<!ELEMENT person - - (name,age|license)>",
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+		{
+			name:    "数字から始まる要素名でエラーが発生する",
+			input:   `<!ELEMENT 1st - O EMPTY>`,
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+		{
+			name:  "成功ケース_名前グループ",
+			input: "<!ELEMENT (SUB|SUP|%phrase;) - - (#PCDATA)*><!ATTLIST (SUB|SUP) id ID #IMPLIED>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Names:        []string{"SUB", "SUP", "%phrase;"},
+						Minimization: true,
+						Content: &Group{
+							Connector:  ConnectorSequence,
+							Children:   []ContentModel{PCDataContent{}},
+							Occurrence: OccurrenceZeroOrMore,
+						},
+					},
+					&AttListDecl{
+						Names: []string{"SUB", "SUP"},
+						Attributes: []AttDef{
+							{Name: "id", Type: "ID", Default: DefaultTypeImplied},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "名前グループに名前トークンがありエラーが発生する",
+			input:   "<!ELEMENT (a|1b) - - EMPTY>",
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+		{
+			name:    "除外例外に名前トークンがありエラーが発生する",
+			input:   `<!ELEMENT A - - (#PCDATA) -(2nd)>`,
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+		{
+			name:    "閉じ括弧がなくエラーが発生する",
+			input:   "<!ELEMENT person - O (name>",
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+		{
+			name:    "閉じ山括弧がなくエラーが発生する",
+			input:   "<!ELEMENT person - O (name)",
+			want:    nil,
+			wantErr: ErrElementParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAttListParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name: "成功ケース_属性の数が2つ",
+			input: `
+<!ATTLIST HTML
+lang    NAME      #IMPLIED
+version CDATA     #FIXED   '-//W3C//DTD HTML 4.01 Transitional//EN'
+>
+			`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&AttListDecl{
+						Name: "HTML",
+						Attributes: []AttDef{
+							{
+								Name:    "lang",
+								Type:    "NAME",
+								Default: DefaultTypeImplied,
+							},
+							{
+								Name:    "version",
+								Type:    "CDATA",
+								Default: DefaultTypeFixed,
+								Value:   "-//W3C//DTD HTML 4.01 Transitional//EN",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_列挙型と既定値",
+			input: `<!ATTLIST p align (left|right) "left" id NAME #REQUIRED>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&AttListDecl{
+						Name: "p",
+						Attributes: []AttDef{
+							{
+								Name:        "align",
+								Enumeration: []string{"left", "right"},
+								Default:     DefaultTypeValue,
+								Value:       "left",
+							},
+							{
+								Name:    "id",
+								Type:    "NAME",
+								Default: DefaultTypeRequired,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_SGMLの既定値",
+			input: `<!ATTLIST LI type NAME #CURRENT ref IDREF #CONREF>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&AttListDecl{
+						Name: "LI",
+						Attributes: []AttDef{
+							{
+								Name:    "type",
+								Type:    "NAME",
+								Default: DefaultTypeCurrent,
+							},
+							{
+								Name:    "ref",
+								Type:    "IDREF",
+								Default: DefaultTypeConRef,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_名前トークンの列挙と既定値",
+			input: `<!ATTLIST TABLE border (0|1|-1|.5) 0 cols NUMBER 12>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&AttListDecl{
+						Name: "TABLE",
+						Attributes: []AttDef{
+							{
+								Name:        "border",
+								Enumeration: []string{"0", "1", "-1", ".5"},
+								Default:     DefaultTypeValue,
+								Value:       "0",
+							},
+							{
+								Name:    "cols",
+								Type:    "NUMBER",
+								Default: DefaultTypeValue,
+								Value:   "12",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_引用符で囲まない固定値",
+			input: `<!ATTLIST p v CDATA #FIXED 1.0 lang NAME #FIXED en>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&AttListDecl{
+						Name: "p",
+						Attributes: []AttDef{
+							{
+								Name:    "v",
+								Type:    "CDATA",
+								Default: DefaultTypeFixed,
+								Value:   "1.0",
+							},
+							{
+								Name:    "lang",
+								Type:    "NAME",
+								Default: DefaultTypeFixed,
+								Value:   "en",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "固定値がなくエラーが発生する",
+			input:   `<!ATTLIST p v CDATA #FIXED>`,
+			want:    nil,
+			wantErr: ErrAttListParse,
+		},
+		{
+			name:    "数字から始まる属性名でエラーが発生する",
+			input:   `<!ATTLIST TABLE 1border NUMBER #IMPLIED>`,
+			want:    nil,
+			wantErr: ErrAttListParse,
+		},
+		{
+			name:    "存在しない属性の型でエラーが発生する",
+			input:   `<!ATTLIST HTML lang LANG #IMPLIED>`,
+			want:    nil,
+			wantErr: ErrAttListParse,
+		},
+		{
+			name:    "既定値の指定がなくエラーが発生する",
+			input:   `<!ATTLIST HTML lang NAME>`,
+			want:    nil,
+			wantErr: ErrAttListParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEntityParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_パラメータ実体",
+			input: `<!ENTITY % html.content "HEAD, BODY">`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:      "html.content",
+						Parameter: true,
+						Value:     "HEAD, BODY",
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_既定の実体",
+			input: `<!ENTITY #DEFAULT "?">`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:  "#DEFAULT",
+						Value: "?",
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_文字参照を含む実体の値",
+			input: `<!ENTITY lt "&#38;#60;"><!ENTITY quot '"&#39;'>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:   "lt",
+						Value:  "&#60;",
+						Source: "&#38;#60;",
+					},
+					&EntityDecl{
+						Name:   "quot",
+						Value:  `"'`,
+						Source: `"&#39;`,
+					},
+				},
+			},
+		},
+		{
+			name: "成功ケース_外部パラメータ実体",
+			input: `<!ENTITY % HTMLlat1 PUBLIC
+       "-//W3C//ENTITIES Latin 1//EN//HTML"
+       "http://www.w3.org/TR/html4/HTMLlat1.ent">`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:      "HTMLlat1",
+						Parameter: true,
+						External: &ExternalID{
+							PublicID: "-//W3C//ENTITIES Latin 1//EN//HTML",
+							SystemID: "http://www.w3.org/TR/html4/HTMLlat1.ent",
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_解析対象外の実体",
+			input: `<!ENTITY logo SYSTEM "logo.gif" NDATA gif>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:     "logo",
+						DataType: EntityDataNData,
+						External: &ExternalID{SystemID: "logo.gif"},
+						Notation: "gif",
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_SGMLの実体の種類",
+			input: `<!ENTITY nbsp CDATA "&#160;" -- no-break space --><!ENTITY b SDATA "[b]"><!ENTITY doc PUBLIC "-//X//DOC" SUBDOC><!ENTITY ch SYSTEM>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:     "nbsp",
+						DataType: EntityDataCData,
+						Value:    "\u00a0",
+						Source:   "&#160;",
+						Comments: []string{" no-break space "},
+					},
+					&EntityDecl{
+						Name:     "b",
+						DataType: EntityDataSData,
+						Value:    "[b]",
+					},
+					&EntityDecl{
+						Name:     "doc",
+						DataType: EntityDataSubDoc,
+						External: &ExternalID{PublicID: "-//X//DOC"},
+					},
+					&EntityDecl{
+						Name:     "ch",
+						External: &ExternalID{},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_一般実体参照を含む値",
+			input: `<!ENTITY copy "&#169; &year; &owner;">`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:       "copy",
+						Value:      "\u00a9 &year; &owner;",
+						Source:     "&#169; &year; &owner;",
+						References: []string{"year", "owner"},
+					},
+				},
+			},
+		},
+		{
+			name:    "解析対象外のパラメータ実体でエラーが発生する",
+			input:   `<!ENTITY % logo SYSTEM "logo.gif" NDATA gif>`,
+			want:    nil,
+			wantErr: ErrEntityParse,
+		},
+		{
+			name:    "公開識別子がなくエラーが発生する",
+			input:   `<!ENTITY a PUBLIC>`,
+			want:    nil,
+			wantErr: ErrEntityParse,
+		},
+		{
+			name:    "記法名がなくエラーが発生する",
+			input:   `<!ENTITY logo SYSTEM "logo.gif" NDATA>`,
+			want:    nil,
+			wantErr: ErrEntityParse,
+		},
+		{
+			name:    "実体の値がなくエラーが発生する",
+			input:   `<!ENTITY % html.content>`,
+			want:    nil,
+			wantErr: ErrEntityParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNotationParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_記法宣言と解析対象外の実体",
+			input: `<!NOTATION gif SYSTEM "image/gif"><!NOTATION jpeg PUBLIC "-//X//NOTATION JPEG//EN" -- JPEG --><!ENTITY logo SYSTEM "logo.gif" NDATA gif>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&NotationDecl{
+						Name:     "gif",
+						External: &ExternalID{SystemID: "image/gif"},
+					},
+					&NotationDecl{
+						Name:     "jpeg",
+						External: &ExternalID{PublicID: "-//X//NOTATION JPEG//EN"},
+						Comments: []string{" JPEG "},
+					},
+					&EntityDecl{
+						Name:     "logo",
+						DataType: EntityDataNData,
+						External: &ExternalID{SystemID: "logo.gif"},
+						Notation: "gif",
+					},
+				},
+			},
+		},
+		{
+			name:    "外部識別子がなくエラーが発生する",
+			input:   `<!NOTATION gif "image/gif">`,
+			want:    nil,
+			wantErr: ErrNotationParse,
+		},
+		{
+			name:    "公開識別子がなくエラーが発生する",
+			input:   `<!NOTATION gif PUBLIC>`,
+			want:    nil,
+			wantErr: ErrNotationParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPEReferenceParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name:  "成功ケース_内容モデル",
+			input: `<!ELEMENT %heading; - - (%inline;|BR)* -(%pre.exclusion;)>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "%heading;",
+						Minimization: true,
+						Content: &Group{
+							Connector: ConnectorChoice,
+							Children: []ContentModel{
+								&PEReferenceContent{Name: "inline"},
+								&ElementContent{Name: "BR"},
+							},
+							Occurrence: OccurrenceZeroOrMore,
+						},
+						Exclusions: []string{"%pre.exclusion;"},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_内容モデル全体が参照",
+			input: `<!ELEMENT %html.qname; %html.content;>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:    "%html.qname;",
+						Content: &PEReferenceContent{Name: "html.content"},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_属性定義",
+			input: `<!ATTLIST A %attrs; -- 共通の属性 -- shape (%Shape;|rect) rect charset %Charset; #IMPLIED>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&AttListDecl{
+						Name: "A",
+						Attributes: []AttDef{
+							{
+								Reference: "attrs",
+								Comments:  []string{" 共通の属性 "},
+							},
+							{
+								Name:        "shape",
+								Enumeration: []string{"%Shape;", "rect"},
+								Default:     DefaultTypeValue,
+								Value:       "rect",
+							},
+							{
+								Name:    "charset",
+								Type:    "%Charset;",
+								Default: DefaultTypeImplied,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "成功ケース_宣言の外の参照",
+			input: "<!ENTITY % HTMLlat1 SYSTEM \"HTMLlat1.ent\">\n%HTMLlat1;",
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{
+						Name:      "HTMLlat1",
+						Parameter: true,
+						External:  &ExternalID{SystemID: "HTMLlat1.ent"},
+					},
+					&PEReferenceDecl{Name: "HTMLlat1"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMarkedSectionParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name: "成功ケース_入れ子の条件付きセクション",
+			input: `<!ENTITY % reserved "IGNORE">
+<![ INCLUDE [
+<!ELEMENT a - O EMPTY>
+<![ %reserved; [ <!ELEMENT b - O EMPTY> ]]>
+]]>`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&EntityDecl{Name: "reserved", Parameter: true, Value: "IGNORE"},
+					&MarkedSection{
+						Keywords: []string{"INCLUDE"},
+						Declarations: []Declaration{
+							&ElementDecl{Name: "a", Minimization: true, OmitEndTag: true, Content: EmptyContent{}},
+							&MarkedSection{
+								Keywords: []string{"%reserved;"},
+								Ignored:  true,
+								Text:     " <!ELEMENT b - O EMPTY> ",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "閉じられていない条件付きセクションでエラーが発生する",
+			input:   "<![ INCLUDE [ <!ELEMENT a - O EMPTY>",
+			want:    nil,
+			wantErr: ErrMarkedSectionParse,
+		},
+		{
+			name:    "対応する開始のない条件付きセクションの終わりでエラーが発生する",
+			input:   "<!ELEMENT a - O EMPTY> ]]>",
+			want:    nil,
+			wantErr: ErrDeclarationParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessingInstructionParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name:  "成功ケース",
+			input: "<?xml version=\"1.0\" encoding=\"UTF-8\"?><?page break?><?NewPage>",
+			want: &DTD{
+				Declarations: []Declaration{
+					&TextDecl{Version: "1.0", Encoding: "UTF-8"},
+					&ProcessingInstructionDecl{Target: "page", Data: "break"},
+					&ProcessingInstructionDecl{Target: "NewPage"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommentParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *DTD
+		wantErr error
+	}{
+		{
+			name: "成功ケース_宣言の前後のコメント",
+			input: `<!-- 子要素のパターン -->
+<!ELEMENT person - - EMPTY>
+<!-- end -->`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&CommentDecl{Text: " 子要素のパターン "},
+					&ElementDecl{
+						Name:         "person",
+						Minimization: true,
+						Content:      EmptyContent{},
+					},
+					&CommentDecl{Text: " end "},
+				},
+			},
+		},
+		{
+			name: "成功ケース_宣言の中のコメント",
+			input: `<!ELEMENT a - - (#PCDATA)* -- anchor -->
+<!ATTLIST a -- 属性 --
+  href CDATA #IMPLIED -- URI for linked resource --
+  name CDATA #IMPLIED
+  >`,
+			want: &DTD{
+				Declarations: []Declaration{
+					&ElementDecl{
+						Name:         "a",
+						Minimization: true,
+						Content: &Group{
+							Connector:  ConnectorSequence,
+							Children:   []ContentModel{PCDataContent{}},
+							Occurrence: OccurrenceZeroOrMore,
+						},
+						Comments: []string{" anchor "},
+					},
+					&AttListDecl{
+						Name: "a",
+						Attributes: []AttDef{
+							{
+								Name:     "href",
+								Type:     "CDATA",
+								Default:  DefaultTypeImplied,
+								Comments: []string{" URI for linked resource "},
+							},
+							{
+								Name:    "name",
+								Type:    "CDATA",
+								Default: DefaultTypeImplied,
+							},
+						},
+						Comments: []string{" 属性 "},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewLexer(tt.input).Execute()
+			if err != nil {
+				t.Fatalf("failed to lex input: %v", err)
+			}
+			sut := NewParser(tokens)
+			got, err := sut.Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStreamParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Declaration
+		wantErr error
+	}{
+		{
+			name:  "成功ケース",
+			input: "<!-- 人物 -->\n<!ELEMENT person - O (name)>\n<!ENTITY % a 'b'>",
+			want: []Declaration{
+				&CommentDecl{Text: " 人物 "},
+				&ElementDecl{
+					Name:         "person",
+					Minimization: true,
+					OmitStartTag: false,
+					OmitEndTag:   true,
+					Content:      &Group{Connector: ConnectorSequence, Children: []ContentModel{&ElementContent{Name: "name"}}},
+				},
+				&EntityDecl{Name: "a", Parameter: true, Value: "b"},
+			},
+		},
+		{
+			name:    "構文解析の前に字句解析でエラーが発生する",
+			input:   "<!ELEMENT person - O (name)>\n<!ELEMENT a - O (b,'c)>",
+			want:    []Declaration{&ElementDecl{Name: "person", Minimization: true, OmitEndTag: true, Content: &Group{Connector: ConnectorSequence, Children: []ContentModel{&ElementContent{Name: "name"}}}}},
+			wantErr: ErrStringTokenize,
+		},
+		{
+			name:    "閉じられていない宣言でエラーが発生する",
+			input:   "<!ELEMENT person - O (name)",
+			want:    []Declaration{},
+			wantErr: ErrElementParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewStreamParser(NewReaderLexer(iotest.OneByteReader(strings.NewReader(tt.input))))
+			got := []Declaration{}
+			var err error
+			for {
+				var decl Declaration
+				decl, err = sut.NextDeclaration()
+				if err != nil {
+					break
+				}
+				got = append(got, decl)
+			}
+			if tt.wantErr == nil && err != io.EOF {
+				t.Errorf("error mismatch want: %v, but got %v", io.EOF, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParserError(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantMessage string
+		wantErr     error
+	}{
+		{
+			name:        "期待したトークンと異なる",
+			input:       "<!ELEMENT p - O\n  (a|b>",
+			wantMessage: `2:7: unexpected token ">" in model group: failed to element parse`,
+			wantErr:     ErrElementParse,
+		},
+		{
+			name:        "綴りの近い予約語を案内する",
+			input:       "<!ATTLIST a\n  b CDAT #IMPLIED>",
+			wantMessage: `2:5: unknown type "CDAT" of attribute "b": failed to attlist parse: did you mean CDATA?`,
+			wantErr:     ErrAttListParse,
+		},
+		{
+			name:        "入力の終わりで失敗すると最後のトークンの直後の位置になる",
+			input:       "<!ELEMENT p - O EMPTY",
+			wantMessage: `1:22: expected ">" but reached end of input: failed to element parse`,
+			wantErr:     ErrElementParse,
+		},
+		{
+			name:        "パラメータ実体の記法",
+			input:       "<!ENTITY % a SYSTEM \"a.gif\" NDATA gif>",
+			wantMessage: `1:29: parameter entity "a" cannot be NDATA: failed to entity parse`,
+			wantErr:     ErrEntityParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStreamParser(NewLexer(tt.input)).Execute()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error mismatch want: %v, but got %v", tt.wantErr, err)
+			}
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("error is not SyntaxError: %v", err)
+			}
+			if diff := cmp.Diff(syntaxErr.Error(), tt.wantMessage); diff != "" {
+				t.Errorf("message mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	for _, in := range benchmarkInputs(b) {
+		b.Run(in.name, func(b *testing.B) {
+			tokens, err := NewLexer(in.data).Execute()
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(in.data)))
+			b.ReportAllocs()
+			reportAllocsPerToken(b, len(tokens), func() {
+				if _, err := NewStreamParser(NewLexer(in.data)).Execute(); err != nil {
+					b.Fatal(err)
+				}
+			})
+		})
+	}
+}
+
+func TestDeclarationString(t *testing.T) {
+	// 構文解析した宣言を書き出すと元の入力に戻り、読み直しても同じ宣言になる
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "成功ケース_タグ省略指定",
+			input: "<!ELEMENT EM - - (#PCDATA)>\n<!ELEMENT BR - O EMPTY>\n<!ELEMENT b (#PCDATA)>",
+		},
+		{
+			name:  "成功ケース_記法宣言",
+			input: "<!NOTATION gif SYSTEM \"image/gif\">\n<!NOTATION jpeg PUBLIC \"-//X//NOTATION JPEG//EN\" \"jpeg\">",
+		},
+		{
+			name:  "成功ケース_除外例外と包含例外",
+			input: "<!ELEMENT BODY O O (%block;)+ -(BODY) +(INS|DEL)>",
+		},
+		{
+			name:  "成功ケース_文字参照を含む実体の値",
+			input: `<!ENTITY amp "&#38;">` + "\n" + `<!ENTITY x "&#38;amp; &amp;">`,
+		},
+		{
+			name:  "成功ケース_文字参照を含む既定値",
+			input: "<!ATTLIST a\n  b CDATA \"&#34;'\"\n  c CDATA #FIXED \"&#60;\">",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := parseString(t, tt.input)
+			decls := []string{}
+			for _, decl := range want.Declarations {
+				decls = append(decls, decl.String())
+			}
+			output := strings.Join(decls, "\n")
+			if diff := cmp.Diff(output, tt.input); diff != "" {
+				t.Errorf("string mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(parseString(t, output), want); diff != "" {
+				t.Errorf("reparse mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func parseString(t *testing.T, input string) *DTD {
+	t.Helper()
+	tokens, err := NewLexer(input).Execute()
+	if err != nil {
+		t.Fatalf("failed to lex input: %v", err)
+	}
+	dtd, err := NewParser(tokens).Execute()
+	if err != nil {
+		t.Fatalf("failed to parse input: %v", err)
+	}
+	return dtd
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// editDistance 2つの文字列の編集距離(文字単位)
+// 打ち間違いで多い隣り合う2文字の入れ替えも1回の編集として数える
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = minInt(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = minInt(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// suggest candidatesの中からwordに最も綴りが近いものを返す
+// 候補の長さの3分の1(最低1文字)より多く異なる場合は打ち間違いとみなさず空文字を返す
+// 1文字の名前同士のように候補の長さ以上に異なる場合も、どの名前とも近いので候補にしない
+func suggest(word string, candidates []string) string {
+	best := ""
+	bestDistance := 0
+	for _, candidate := range candidates {
+		if candidate == word {
+			continue
+		}
+		d := editDistance(word, candidate)
+		limit := len([]rune(candidate)) / 3
+		if limit < 1 {
+			limit = 1
+		}
+		if d > limit || d >= len([]rune(candidate)) {
+			continue
+		}
+		if best == "" || d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// suggestKeyword keywordsの中からliteralに最も綴りが近い予約語を返す
+// 予約語は大文字で書くので、小文字で書いた場合も候補にする
+func suggestKeyword(literal string, keywords []TokenType) string {
+	candidates := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		candidates = append(candidates, keyword.Literal())
+	}
+	if s := suggest(strings.ToUpper(literal), candidates); s != "" {
+		return s
+	}
+	// 大文字にすると予約語と一致する場合
+	if keyword, ok := findKeyword(strings.ToUpper(literal), keywords); ok && keyword.Literal() != literal {
+		return keyword.Literal()
+	}
+	return ""
+}
+
+// didYouMean 候補があれば ": did you mean X?" を返す
+func didYouMean(suggestion string) string {
+	if suggestion == "" {
+		return ""
+	}
+	return fmt.Sprintf(": did you mean %s?", suggestion)
+}
+
+// withSuggestion 綴りの近い候補があればエラーの末尾で案内する
+func withSuggestion(err error, suggestion string) error {
+	if suggestion == "" {
+		return err
+	}
+	return fmt.Errorf("%w%s", err, didYouMean(suggestion))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError 字句解析と構文解析の失敗箇所の情報を持つエラー
+// errors.Is で ErrElementTokenize や ErrElementParse などの元のエラーと比較できる
+type SyntaxError struct {
+	Err      error    // ErrElementTokenize などの元のエラー
+	Pos      Position // 失敗したトークンの開始位置
+	Text     string   // 失敗したトークンの文字列
+	Expected string   // 本来期待していた文字列
+	// Suggestion 綴りを誤ったとみなせる場合の、綴りが最も近い予約語や名前
+	Suggestion string
+	// Expansion パラメータ実体の値を展開した部分で失敗した場合の、元の入力の参照(%name;)
+	// Posはこの参照の位置になる
+	Expansion string
+
+	source       string // 失敗した行を含む入力
+	sourceOffset int    // sourceの先頭の、入力全体でのバイト単位のインデックス
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Pos, e.Err)
+	if e.Suggestion != "" {
+		// ELEMINT: did you mean ELEMENT?
+		msg += ": " + e.Text + didYouMean(e.Suggestion)
+	} else {
+		if e.Text != "" {
+			msg += fmt.Sprintf(": found %q", e.Text)
+		}
+		if e.Expected != "" {
+			msg += fmt.Sprintf(", expected %s", e.Expected)
+		}
+	}
+	if e.Expansion != "" {
+		msg += fmt.Sprintf(" (in expansion of %s)", e.Expansion)
+	}
+	return msg
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet 失敗した行とその下に失敗箇所を示すキャレットを並べた文字列
+//
+//	<!ELEMINT person - O (name)>
+//	  ^~~~~~~
+func (e *SyntaxError) Snippet() string {
+	offset := e.Pos.Offset - e.sourceOffset
+	if offset < 0 || offset > len(e.source) {
+		return ""
+	}
+	// io.Readerから読んだ場合、長い行は先頭が捨てられていることがある
+	lineStart := strings.LastIndexByte(e.source[:offset], '\n') + 1
+	line := e.source[lineStart:]
+	if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+		line = line[:i]
+	}
+
+	// タブ幅が変わってもずれないよう、キャレットの前はタブをそのまま残す
+	indent := ""
+	for _, r := range e.source[lineStart:offset] {
+		if r == '\t' {
+			indent += "\t"
+		} else {
+			indent += strings.Repeat(" ", runeWidth(r))
+		}
+	}
+	text := e.Text
+	if e.Expansion != "" {
+		text = e.Expansion
+	}
+	if i := strings.IndexAny(text, "\r\n"); i >= 0 {
+		text = text[:i]
+	}
+	width := 0
+	for _, r := range text {
+		width += runeWidth(r)
+	}
+	marker := "^"
+	if width > 1 {
+		marker += strings.Repeat("~", width-1)
+	}
+	return line + "\n" + indent + marker
+}
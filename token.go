@@ -1,35 +1,256 @@
 package main
 
-type TokenType string
+import (
+	"fmt"
+)
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Start   Position  `json:"start"` // トークンの先頭の文字の位置
+	End     Position  `json:"end"`   // トークンの末尾の文字の直後の位置
+	// References 文字列中の &name; の一般実体参照の実体名(参照はLiteralにそのまま残す)
+	References []string `json:"references,omitempty"`
+	// PEReferences ENTITY宣言の値の中の %name; のパラメータ実体参照の実体名(参照はLiteralにそのまま残す)
+	PEReferences []string `json:"peReferences,omitempty"`
+	// Source 文字参照を含む文字列の、文字参照を置き換える前の引用符の中の文字列(含まない場合は空)
+	// &#38;amp; と &amp; のように、置き換えた後のLiteralでは区別できない値を書き戻すために使う
+	Source string `json:"source,omitempty"`
+
+	// 以下はNewTriviaLexerで読んだ場合のみ持つ
+	Leading  string `json:"leading,omitempty"`  // トークンの前の空白とコメント
+	Raw      string `json:"raw,omitempty"`      // 入力中のトークンの文字列そのもの
+	Trailing string `json:"trailing,omitempty"` // トークンの後ろの、同じ行の空白とタブ
+}
+
+// Text トークンの前後の空白とコメントを含めた入力中の文字列
+// NewTriviaLexerで読んだトークンを全て繋げると元の入力と一致する
+func (t Token) Text() string {
+	return t.Leading + t.Raw + t.Trailing
+}
+
+// Position 入力中の位置
+type Position struct {
+	Offset int `json:"offset"` // 0始まりのバイト単位の位置
+	Line   int `json:"line"`   // 1始まりの行番号
+	Column int `json:"column"` // 1始まりの桁番号
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
+// TokenType トークンの種類
+// 種類ごとに異なる値を持ち、String()で種類の名前を返す。JSONでは種類の名前の文字列になる
+type TokenType int
+
 const (
-	LeftAngleBracket     = "<"
-	RightAngleBracket    = ">"
-	Exclamation          = "!"
-	Element              = "ELEMENT"
-	Name                 = "Name"
-	LeftBracket          = "("
-	RightBracket         = ")"
-	Comma                = ","
-	Asterisk             = "*"
-	TagNeed              = "-"
-	TagUnNeed            = "O"
-	Ampersand            = "&"
-	VerticalLine         = "|"
-	Plus                 = "+"
-	Question             = "?"
-	Empty                = "EMPTY"
-	Minus                = "-"
-	AttList              = "ATTLIST"
-	DefaultValueImplied  = "#IMPLIED"
-	DefaultValueRequired = "#REQUIRED"
-	DefaultValueFixed    = "#FIXED"
-	String               = "String"
-	Entity               = "ENTITY"
-	Percent              = "%"
+	Illegal TokenType = iota // ゼロ値。トークンがないことを表す
+	LeftAngleBracket
+	RightAngleBracket
+	Exclamation
+	Element
+	Name
+	NameToken // 数字や . - から始まる名前トークン(XMLのNmtoken)
+	LeftBracket
+	RightBracket
+	Comma
+	Asterisk
+	TagNeed
+	TagUnNeed
+	Ampersand
+	VerticalLine
+	Plus
+	Question
+	Empty
+	Minus
+	Inclusion
+	Exclusion
+	AttList
+	DefaultValueImplied
+	DefaultValueRequired
+	DefaultValueFixed
+	String
+	Entity
+	Percent
+	Semicolon
+	PCData
+	Any
+	Comment
+	PEReference
+	MarkedSectionStart
+	MarkedSectionEnd
+	LeftSquareBracket
+	IgnoredSection
+	ProcessingInstruction
+	EOF // 入力の末尾(NewTriviaLexerの場合のみ)
+
+	// 以下は宣言の中で予約語として扱う名前
+	// 同じ綴りの予約語は宣言の種類が違っても同じトークンの種類になる
+
+	// 宣言の種類
+	Notation
+	ShortRef // SGML
+	UseMap   // SGML
+
+	// ELEMENT宣言の宣言内容(SGML)
+	CData
+	RCData
+
+	// ATTLIST宣言の属性の型(CDATA, ENTITY, NOTATIONは他の宣言と共通)
+	AttTypeID
+	AttTypeIDRef
+	AttTypeIDRefs
+	AttTypeEntities
+	AttTypeNMToken
+	AttTypeNMTokens
+	AttTypeName     // SGML
+	AttTypeNames    // SGML
+	AttTypeNumber   // SGML
+	AttTypeNumbers  // SGML
+	AttTypeNuToken  // SGML
+	AttTypeNuTokens // SGML
+
+	// ATTLIST宣言の既定値(SGML)
+	DefaultValueCurrent
+	DefaultValueConRef
+
+	// ENTITY宣言とNOTATION宣言の外部識別子と実体の種類
+	System
+	Public
+	NData
+	EntityTypeSData    // SGML
+	EntityTypePI       // SGML
+	EntityTypeStartTag // SGML
+	EntityTypeEndTag   // SGML
+	EntityTypeMS       // SGML
+	EntityTypeMD       // SGML
+	EntityTypeSubDoc   // SGML
+	DefaultEntity      // SGMLの既定の実体名
+
+	// 条件付きセクションとマーク区間の状態
+	Include
+	Ignore
+	Temp // SGML
 )
+
+// tokenTypes 種類ごとの名前と、記号や予約語のように決まった綴りがある場合の綴り
+var tokenTypes = [...]struct {
+	name    string
+	literal string
+}{
+	Illegal:               {name: "Illegal"},
+	LeftAngleBracket:      {name: "LeftAngleBracket", literal: "<"},
+	RightAngleBracket:     {name: "RightAngleBracket", literal: ">"},
+	Exclamation:           {name: "Exclamation", literal: "!"},
+	Element:               {name: "Element", literal: "ELEMENT"},
+	Name:                  {name: "Name"},
+	NameToken:             {name: "NameToken"},
+	LeftBracket:           {name: "LeftBracket", literal: "("},
+	RightBracket:          {name: "RightBracket", literal: ")"},
+	Comma:                 {name: "Comma", literal: ","},
+	Asterisk:              {name: "Asterisk", literal: "*"},
+	TagNeed:               {name: "TagNeed"},
+	TagUnNeed:             {name: "TagUnNeed"},
+	Ampersand:             {name: "Ampersand", literal: "&"},
+	VerticalLine:          {name: "VerticalLine", literal: "|"},
+	Plus:                  {name: "Plus", literal: "+"},
+	Question:              {name: "Question", literal: "?"},
+	Empty:                 {name: "Empty", literal: "EMPTY"},
+	Minus:                 {name: "Minus", literal: "-"},
+	Inclusion:             {name: "Inclusion"},
+	Exclusion:             {name: "Exclusion"},
+	AttList:               {name: "AttList", literal: "ATTLIST"},
+	DefaultValueImplied:   {name: "DefaultValueImplied", literal: "#IMPLIED"},
+	DefaultValueRequired:  {name: "DefaultValueRequired", literal: "#REQUIRED"},
+	DefaultValueFixed:     {name: "DefaultValueFixed", literal: "#FIXED"},
+	String:                {name: "String"},
+	Entity:                {name: "Entity", literal: "ENTITY"},
+	Percent:               {name: "Percent", literal: "%"},
+	Semicolon:             {name: "Semicolon", literal: ";"},
+	PCData:                {name: "PCData", literal: "#PCDATA"},
+	Any:                   {name: "Any", literal: "ANY"},
+	Comment:               {name: "Comment"},
+	PEReference:           {name: "PEReference"},
+	MarkedSectionStart:    {name: "MarkedSectionStart", literal: "<!["},
+	MarkedSectionEnd:      {name: "MarkedSectionEnd", literal: "]]>"},
+	LeftSquareBracket:     {name: "LeftSquareBracket", literal: "["},
+	IgnoredSection:        {name: "IgnoredSection"},
+	ProcessingInstruction: {name: "ProcessingInstruction"},
+	EOF:                   {name: "EOF"},
+	Notation:              {name: "Notation", literal: "NOTATION"},
+	ShortRef:              {name: "ShortRef", literal: "SHORTREF"},
+	UseMap:                {name: "UseMap", literal: "USEMAP"},
+	CData:                 {name: "CData", literal: "CDATA"},
+	RCData:                {name: "RCData", literal: "RCDATA"},
+	AttTypeID:             {name: "AttTypeID", literal: "ID"},
+	AttTypeIDRef:          {name: "AttTypeIDRef", literal: "IDREF"},
+	AttTypeIDRefs:         {name: "AttTypeIDRefs", literal: "IDREFS"},
+	AttTypeEntities:       {name: "AttTypeEntities", literal: "ENTITIES"},
+	AttTypeNMToken:        {name: "AttTypeNMToken", literal: "NMTOKEN"},
+	AttTypeNMTokens:       {name: "AttTypeNMTokens", literal: "NMTOKENS"},
+	AttTypeName:           {name: "AttTypeName", literal: "NAME"},
+	AttTypeNames:          {name: "AttTypeNames", literal: "NAMES"},
+	AttTypeNumber:         {name: "AttTypeNumber", literal: "NUMBER"},
+	AttTypeNumbers:        {name: "AttTypeNumbers", literal: "NUMBERS"},
+	AttTypeNuToken:        {name: "AttTypeNuToken", literal: "NUTOKEN"},
+	AttTypeNuTokens:       {name: "AttTypeNuTokens", literal: "NUTOKENS"},
+	DefaultValueCurrent:   {name: "DefaultValueCurrent", literal: "#CURRENT"},
+	DefaultValueConRef:    {name: "DefaultValueConRef", literal: "#CONREF"},
+	System:                {name: "System", literal: "SYSTEM"},
+	Public:                {name: "Public", literal: "PUBLIC"},
+	NData:                 {name: "NData", literal: "NDATA"},
+	EntityTypeSData:       {name: "EntityTypeSData", literal: "SDATA"},
+	EntityTypePI:          {name: "EntityTypePI", literal: "PI"},
+	EntityTypeStartTag:    {name: "EntityTypeStartTag", literal: "STARTTAG"},
+	EntityTypeEndTag:      {name: "EntityTypeEndTag", literal: "ENDTAG"},
+	EntityTypeMS:          {name: "EntityTypeMS", literal: "MS"},
+	EntityTypeMD:          {name: "EntityTypeMD", literal: "MD"},
+	EntityTypeSubDoc:      {name: "EntityTypeSubDoc", literal: "SUBDOC"},
+	DefaultEntity:         {name: "DefaultEntity", literal: "#DEFAULT"},
+	Include:               {name: "Include", literal: "INCLUDE"},
+	Ignore:                {name: "Ignore", literal: "IGNORE"},
+	Temp:                  {name: "Temp", literal: "TEMP"},
+}
+
+func (t TokenType) String() string {
+	if t < 0 || int(t) >= len(tokenTypes) {
+		return fmt.Sprintf("TokenType(%d)", int(t))
+	}
+	return tokenTypes[t].name
+}
+
+// Literal 記号や予約語のように決まった綴りがある場合はその綴りを返す。名前や文字列などは空文字
+func (t TokenType) Literal() string {
+	if t < 0 || int(t) >= len(tokenTypes) {
+		return ""
+	}
+	return tokenTypes[t].literal
+}
+
+// describe エラーメッセージ用に、決まった綴りがあれば引用符で囲んだ綴りを、なければ種類の名前を返す
+func (t TokenType) describe() string {
+	if literal := t.Literal(); literal != "" {
+		return fmt.Sprintf("%q", literal)
+	}
+	return t.String()
+}
+
+// MarshalText JSONなどでは種類の名前の文字列にする
+func (t TokenType) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(tokenTypes) {
+		return nil, fmt.Errorf("unknown token type %d", int(t))
+	}
+	return []byte(tokenTypes[t].name), nil
+}
+
+// UnmarshalText 種類の名前の文字列から種類を復元する
+func (t *TokenType) UnmarshalText(text []byte) error {
+	for i, tokenType := range tokenTypes {
+		if tokenType.name == string(text) {
+			*t = TokenType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown token type %q", text)
+}
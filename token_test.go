@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenType(t *testing.T) {
+	// 全ての種類に異なる名前があり、名前から同じ種類に戻せる
+	names := map[string]TokenType{}
+	for i := range tokenTypes {
+		tokenType := TokenType(i)
+		name := tokenType.String()
+		if name == "" {
+			t.Errorf("token type %d has no name", i)
+		}
+		if other, ok := names[name]; ok {
+			t.Errorf("token types %d and %d have the same name %q", other, i, name)
+		}
+		names[name] = tokenType
+
+		var got TokenType
+		if err := got.UnmarshalText([]byte(name)); err != nil {
+			t.Errorf("failed to unmarshal %q: %v", name, err)
+		}
+		if got != tokenType {
+			t.Errorf("unmarshal mismatch want: %d, but got %d", tokenType, got)
+		}
+	}
+	if len(tokenTypes) != int(Temp)+1 {
+		t.Errorf("tokenTypes has %d entries, but the last token type is %d", len(tokenTypes), Temp)
+	}
+}
+
+func TestTokenTypeString(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokenType   TokenType
+		wantString  string
+		wantLiteral string
+	}{
+		{
+			name:        "成功ケース_記号",
+			tokenType:   Minus,
+			wantString:  "Minus",
+			wantLiteral: "-",
+		},
+		{
+			name:        "成功ケース_同じ記号の別の種類",
+			tokenType:   TagNeed,
+			wantString:  "TagNeed",
+			wantLiteral: "",
+		},
+		{
+			name:        "成功ケース_予約語",
+			tokenType:   DefaultValueImplied,
+			wantString:  "DefaultValueImplied",
+			wantLiteral: "#IMPLIED",
+		},
+		{
+			name:        "成功ケース_ゼロ値",
+			tokenType:   Illegal,
+			wantString:  "Illegal",
+			wantLiteral: "",
+		},
+		{
+			name:        "存在しない種類",
+			tokenType:   TokenType(-1),
+			wantString:  "TokenType(-1)",
+			wantLiteral: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.tokenType.String(), tt.wantString); diff != "" {
+				t.Errorf("string mismatch (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.tokenType.Literal(), tt.wantLiteral); diff != "" {
+				t.Errorf("literal mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTokenJSON(t *testing.T) {
+	want := []Token{
+		{Type: TagNeed, Literal: "-", Start: Position{Offset: 12, Line: 1, Column: 13}, End: Position{Offset: 13, Line: 1, Column: 14}},
+		{Type: Minus, Literal: "-", Start: Position{Offset: 20, Line: 2, Column: 1}, End: Position{Offset: 21, Line: 2, Column: 2}},
+		{Type: String, Literal: "&a;", References: []string{"a"}},
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var got []Token
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mismatch (-got +want):\n%s", diff)
+	}
+
+	var tokenType TokenType
+	if err := json.Unmarshal([]byte(`"Unknown"`), &tokenType); err == nil {
+		t.Errorf("error mismatch want: unknown token type, but got nil")
+	}
+	if _, err := json.Marshal(TokenType(-1)); err == nil {
+		t.Errorf("error mismatch want: unknown token type, but got nil")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrDuplicateElement = errors.New("duplicate element declaration")
+var ErrUndeclaredElement = errors.New("undeclared element")
+var ErrUndeclaredEntity = errors.New("undeclared parameter entity")
+var ErrUndeclaredNotation = errors.New("undeclared notation")
+
+type validator struct {
+	dtd *DTD
+}
+
+func NewValidator(dtd *DTD) *validator {
+	return &validator{dtd: dtd}
+}
+
+// Execute 宣言同士の整合性を検査し、見つかった問題を全て返す
+func (v *validator) Execute() []error {
+	errs := []error{}
+	decls := includedDeclarations(v.dtd.Declarations)
+	declared := map[string]bool{}
+	elements := []string{}
+	for _, decl := range decls {
+		d, ok := decl.(*ElementDecl)
+		if !ok {
+			continue
+		}
+		for _, name := range d.Elements() {
+			if declared[name] && !isReference(name) {
+				errs = append(errs, errors.Wrapf(ErrDuplicateElement, "element %q", name))
+			}
+			if !declared[name] && !isReference(name) {
+				elements = append(elements, name)
+			}
+			declared[name] = true
+		}
+	}
+
+	for _, decl := range decls {
+		switch d := decl.(type) {
+		case *ElementDecl:
+			names := append(elementNames(d.Content), d.Inclusions...)
+			names = append(names, d.Exclusions...)
+			reported := map[string]bool{}
+			for _, name := range names {
+				// パラメータ実体参照は展開しないとどの要素か分からないので検査しない
+				if !declared[name] && !reported[name] && !isReference(name) {
+					reported[name] = true
+					// 参照元の要素自身は案内しない
+					suggestion := quotedSuggestion(name, withoutNames(elements, d.Elements()))
+					errs = append(errs, withSuggestion(errors.Wrapf(ErrUndeclaredElement, "element %q referenced from %q", name, nameGroupString(d.Name, d.Names)), suggestion))
+				}
+			}
+		case *AttListDecl:
+			for _, name := range d.Elements() {
+				if !declared[name] && !isReference(name) {
+					errs = append(errs, withSuggestion(errors.Wrapf(ErrUndeclaredElement, "attribute list for element %q", name), quotedSuggestion(name, elements)))
+				}
+			}
+		}
+	}
+	errs = append(errs, v.entityReferenceValidate()...)
+	return append(errs, v.notationValidate()...)
+}
+
+// notationValidate NDATAなどの外部実体が宣言されていない記法を使っていないか検査する
+func (v *validator) notationValidate() []error {
+	errs := []error{}
+	declared := map[string]bool{}
+	notations := []string{}
+	walkDeclarations(v.dtd.Declarations, func(decl Declaration) {
+		if d, ok := decl.(*NotationDecl); ok && !declared[d.Name] {
+			declared[d.Name] = true
+			notations = append(notations, d.Name)
+		}
+	})
+	walkDeclarations(v.dtd.Declarations, func(decl Declaration) {
+		if d, ok := decl.(*EntityDecl); ok && d.Notation != "" && !declared[d.Notation] {
+			errs = append(errs, withSuggestion(errors.Wrapf(ErrUndeclaredNotation, "notation %q of entity %q", d.Notation, d.Name), quotedSuggestion(d.Notation, notations)))
+		}
+	})
+	return errs
+}
+
+// entityReferenceValidate 宣言されていないパラメータ実体の参照を探す
+// SGMLでは参照より前に宣言する必要があるが、ここでは宣言の順序までは検査しない
+func (v *validator) entityReferenceValidate() []error {
+	errs := []error{}
+	declared := map[string]bool{}
+	entities := []string{}
+	walkDeclarations(v.dtd.Declarations, func(decl Declaration) {
+		if d, ok := decl.(*EntityDecl); ok && d.Parameter && !declared[d.Name] {
+			declared[d.Name] = true
+			entities = append(entities, d.Name)
+		}
+	})
+	reported := map[string]bool{}
+	walkDeclarations(v.dtd.Declarations, func(decl Declaration) {
+		for _, name := range entityReferences(decl) {
+			if declared[name] || reported[name] {
+				continue
+			}
+			reported[name] = true
+			// 実体の値の中の参照では、宣言中の実体自身は案内しない
+			candidates := entities
+			if d, ok := decl.(*EntityDecl); ok && d.Parameter {
+				candidates = withoutNames(entities, []string{d.Name})
+			}
+			suggestion := suggest(name, candidates)
+			if suggestion != "" {
+				suggestion = referenceString(suggestion)
+			}
+			errs = append(errs, withSuggestion(errors.Wrapf(ErrUndeclaredEntity, "%s", referenceString(name)), suggestion))
+		}
+	})
+	return errs
+}
+
+// walkDeclarations 読み飛ばした条件付きセクションも含め、全ての宣言を出現順に辿る
+func walkDeclarations(decls []Declaration, fn func(Declaration)) {
+	for _, decl := range decls {
+		fn(decl)
+		if section, ok := decl.(*MarkedSection); ok {
+			walkDeclarations(section.Declarations, fn)
+		}
+	}
+}
+
+// entityReferences 宣言の中で参照しているパラメータ実体名を出現順に返す
+func entityReferences(decl Declaration) []string {
+	names := []string{}
+	add := func(values ...string) {
+		for _, value := range values {
+			if isReference(value) {
+				names = append(names, strings.TrimSuffix(value[1:], ";"))
+			}
+		}
+	}
+	switch d := decl.(type) {
+	case *ElementDecl:
+		add(d.Elements()...)
+		names = append(names, contentReferences(d.Content)...)
+		add(d.Inclusions...)
+		add(d.Exclusions...)
+	case *AttListDecl:
+		add(d.Elements()...)
+		for _, def := range d.Attributes {
+			if def.Reference != "" {
+				names = append(names, def.Reference)
+			}
+			add(def.Type)
+			add(def.Enumeration...)
+		}
+	case *MarkedSection:
+		add(d.Keywords...)
+	case *EntityDecl:
+		names = append(names, d.PEReferences...)
+	case *PEReferenceDecl:
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// contentReferences 内容モデル中のパラメータ実体参照の実体名を出現順に返す
+func contentReferences(model ContentModel) []string {
+	names := []string{}
+	switch c := model.(type) {
+	case *PEReferenceContent:
+		names = append(names, c.Name)
+	case *Group:
+		for _, child := range c.Children {
+			names = append(names, contentReferences(child)...)
+		}
+	}
+	return names
+}
+
+// quotedSuggestion namesの中で綴りが最も近い名前を引用符で囲んで返す
+func quotedSuggestion(name string, names []string) string {
+	suggestion := suggest(name, names)
+	if suggestion == "" {
+		return ""
+	}
+	return fmt.Sprintf("%q", suggestion)
+}
+
+// withoutNames namesからexcludedに含まれる名前を除いて返す
+func withoutNames(names, excluded []string) []string {
+	skip := map[string]bool{}
+	for _, name := range excluded {
+		skip[name] = true
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if !skip[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// elementNames 内容モデル中に現れる子要素名を出現順に返す
+func elementNames(model ContentModel) []string {
+	names := []string{}
+	switch c := model.(type) {
+	case *ElementContent:
+		names = append(names, c.Name)
+	case *Group:
+		for _, child := range c.Children {
+			names = append(names, elementNames(child)...)
+		}
+	}
+	return names
+}